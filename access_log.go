@@ -0,0 +1,214 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"encoding/json"
+	"golang.org/x/mod/module"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessEntry is the record of a served request
+type AccessEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	//remote address, user of basic authorization and user agent of client
+	Remote string `json:"remote"`
+	User   string `json:"user,omitempty"`
+	Agent  string `json:"agent,omitempty"`
+	//parsed request, empty if the path is invalid
+	Cmd     string  `json:"cmd,omitempty"`
+	SumCmd  string  `json:"sum_cmd,omitempty"`
+	SumDB   string  `json:"sumdb,omitempty"`
+	Module  Module  `json:"module,omitempty"`
+	Version Version `json:"version,omitempty"`
+	//names of resolvers served the request (comma separated when versions are merged)
+	Resolver string `json:"resolver,omitempty"`
+	Status   int    `json:"status"`
+	//bytes of body written
+	Bytes int64 `json:"bytes"`
+	//seconds to serve the request
+	Latency float64 `json:"latency"`
+}
+
+// AccessLogger record served requests, it's called after the response is written.
+type AccessLogger interface {
+	Log(entry *AccessEntry)
+}
+
+// JSONAccessLogger write entries as JSON lines
+type JSONAccessLogger struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewJSONAccessLogger(w io.Writer) *JSONAccessLogger {
+	return &JSONAccessLogger{w: w}
+}
+
+// OpenAuditLog open an append-only JSON lines file, create it if not exists.
+func OpenAuditLog(path string) (*JSONAccessLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONAccessLogger(f), nil
+}
+
+func (l *JSONAccessLogger) Log(entry *AccessEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, _ = l.w.Write(append(b, '\n'))
+}
+
+// close the writer if it's an io.Closer
+func (l *JSONAccessLogger) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+//a ResponseWriter counts status and bytes
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+//region served resolvers
+
+type servedByKey struct{}
+
+//records names of resolvers served a request
+type servedBy struct {
+	lock sync.Mutex
+	name string
+}
+
+func (s *servedBy) set(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.name = name
+}
+
+func (s *servedBy) get() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.name
+}
+
+func withServedBy(ctx context.Context, rec *servedBy) context.Context {
+	return context.WithValue(ctx, servedByKey{}, rec)
+}
+
+//a value with names of resolvers served it
+type servedValue struct {
+	value interface{}
+	name  string
+}
+
+//record names of resolvers with register orders, if the context is recording
+func (s *Server) served(ctx context.Context, orders ...int) {
+	rec, ok := ctx.Value(servedByKey{}).(*servedBy)
+	if !ok {
+		return
+	}
+	s.lock.Lock()
+	names := make([]string, 0, len(orders))
+	for _, order := range orders {
+		names = append(names, s.names[order])
+	}
+	s.lock.Unlock()
+	rec.set(strings.Join(names, ","))
+}
+
+//endregion
+
+//log a served request to Logger and Metrics, and to Audit if it's a zip of private module downloaded by GET
+func (s *Server) log(r *http.Request, w *accessWriter, rec *servedBy, start time.Time) {
+	e := &AccessEntry{
+		Time:     start,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Remote:   r.RemoteAddr,
+		Agent:    r.UserAgent(),
+		Resolver: rec.get(),
+		Status:   w.status,
+		Bytes:    w.bytes,
+		Latency:  time.Since(start).Seconds(),
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		e.User = user
+	}
+	req := Request{}
+	if strings.HasPrefix(r.URL.Path, s.Prefix) {
+		req, _ = ParseRequest(strings.TrimPrefix(r.URL.Path, s.Prefix))
+	}
+	if req.Cmd != CmdUndefined {
+		e.Cmd = req.Cmd.String()
+	}
+	if req.SumDB != "" {
+		e.SumCmd = req.SumCmd.String()
+	}
+	e.SumDB, e.Module, e.Version = req.SumDB, req.Module, req.Version
+	if s.Logger != nil {
+		s.Logger.Log(e)
+	}
+	if s.Metrics != nil {
+		s.Metrics.served(e)
+	}
+	if s.Audit != nil && req.Cmd == CmdZip && r.Method == http.MethodGet &&
+		(e.Status == http.StatusOK || e.Status == http.StatusPartialContent) &&
+		s.Private != "" && module.MatchPrefixPatterns(s.Private, string(req.Module)) {
+		s.Audit.Log(e)
+	}
+}
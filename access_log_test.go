@@ -0,0 +1,124 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//decode JSON lines
+func accessEntries(t *testing.T, b []byte) (entries []AccessEntry) {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var e AccessEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+func TestServer_AccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	audit, err := OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := new(bytes.Buffer)
+	s := NewServer("/", 60)
+	s.Logger = NewJSONAccessLogger(logs)
+	s.Audit = audit
+	s.Private = "git.x/private,*.corp"
+	assert.Nil(t, s.RegisterResolver("zip", 0, func(...Resolver) Resolver {
+		return zipResolver{}
+	}))
+	assert.Nil(t, s.RegisterResolver("list", 1, func(...Resolver) Resolver {
+		return JustTestResolver(0)
+	}))
+	s.Initial()
+	for _, path := range []string{
+		"/git.x/private/@v/v1.0.0.zip",
+		"/git.x/public/@v/v1.0.0.zip",
+		"/git.x/public/@v/v1.0.0.mod",
+		"/git.x/public/@v/list",
+		"/git.corp/some/@v/v1.0.0.zip",
+		"/sumdb/sum.x/latest",
+		"/invalid",
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.SetBasicAuth("ci", "secret")
+		s.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	entries := accessEntries(t, logs.Bytes())
+	if assert.Len(t, entries, 7) {
+		e := entries[0]
+		assert.Equal(t, http.MethodGet, e.Method)
+		assert.Equal(t, "ci", e.User)
+		assert.Equal(t, "CmdZip", e.Cmd)
+		assert.Equal(t, Module("git.x/private"), e.Module)
+		assert.Equal(t, Version("v1.0.0"), e.Version)
+		assert.Equal(t, "zip", e.Resolver)
+		assert.Equal(t, http.StatusOK, e.Status)
+		assert.True(t, e.Bytes > 0)
+		assert.Equal(t, "list", entries[3].Resolver)
+		assert.Equal(t, "SumLatest", entries[5].SumCmd)
+		assert.Equal(t, "sum.x", entries[5].SumDB)
+		assert.Equal(t, http.StatusNotFound, entries[5].Status)
+		assert.Equal(t, "", entries[6].Cmd)
+		assert.Equal(t, http.StatusNotFound, entries[6].Status)
+	}
+
+	//audit of private zips only, appended after reopen
+	assert.Nil(t, audit.Close())
+	audit, err = OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Audit = audit
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/git.x/private/@v/v1.0.1.zip", nil))
+	//attempts without a download are not audited
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "/git.x/private/@v/v1.0.2.zip", nil))
+	s.Policy, err = NewPolicy(PolicyRule{Pattern: "git.x/private", Versions: "<v1.1.0"})
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/private/@v/v1.1.0.zip", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Nil(t, audit.Close())
+	b, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	assert.Nil(t, err)
+	var modules []string
+	for _, e := range accessEntries(t, b) {
+		modules = append(modules, string(e.Module)+"@"+string(e.Version))
+	}
+	assert.Equal(t, []string{"git.x/private@v1.0.0", "git.corp/some@v1.0.0", "git.x/private@v1.0.1"}, modules)
+}
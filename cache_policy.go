@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+// CachePolicy is the max-age (seconds) of Cache-Control for responses, no cache when not positive.
+type CachePolicy struct {
+	//successful responses of commands, responses of .info, .mod and .zip of canonical versions are also immutable
+	Cmd map[Cmd]int
+	//successful responses of checksum database commands
+	Sum map[SumCmd]int
+	//.info of versions which are not canonical, as queries of branches or commits
+	Query int
+	//404 and 410 responses
+	Negative int
+}
+
+//max-age of mutable responses in NewCachePolicy
+const mutableCacheAge = 60
+
+// NewCachePolicy cache immutable responses with age: .info, .mod and .zip of canonical versions, checksum database tiles and lookups.
+// mutable responses (list, latest, queries, checksum database latest) and 404 are cached no longer than one minute.
+func NewCachePolicy(age int) CachePolicy {
+	mutable := age
+	if mutable > mutableCacheAge {
+		mutable = mutableCacheAge
+	}
+	return CachePolicy{
+		Cmd: map[Cmd]int{
+			CmdLatest: mutable,
+			CmdList:   mutable,
+			CmdInfo:   age,
+			CmdMod:    age,
+			CmdZip:    age,
+		},
+		Sum: map[SumCmd]int{
+			SumSupported: mutable,
+			SumLatest:    mutable,
+			SumLookup:    age,
+			SumTile:      age,
+		},
+		Query:    mutable,
+		Negative: mutable,
+	}
+}
+
+// Age of successful response of a request, and if the response is immutable.
+func (p CachePolicy) Age(r Request) (age int, immutable bool) {
+	switch r.Cmd {
+	case CmdUndefined:
+		return p.Sum[r.SumCmd], false
+	case CmdInfo:
+		if !IsCanonicalVersion(r.Version) {
+			return p.Query, false
+		}
+		fallthrough
+	case CmdMod, CmdZip:
+		return p.Cmd[r.Cmd], true
+	default:
+		return p.Cmd[r.Cmd], false
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//a resolver serves info
+type infoResolver struct {
+	zipResolver
+}
+
+func (infoResolver) Info(_ Module, version Version) *Info {
+	if version == "none" {
+		return nil
+	}
+	return &Info{Version: "v1.0.0", Time: time.Date(2021, 10, 10, 10, 10, 10, 0, time.UTC)}
+}
+
+func (infoResolver) Versions(Module) Versions {
+	return Versions{"v1.0.0"}
+}
+
+func TestCachePolicy(t *testing.T) {
+	s := NewServer("/", 86400)
+	s.resolvers = []ResolverV2{UpgradeResolver(infoResolver{})}
+	for path, cache := range map[string]string{
+		"/git.x/some/@v/list":                "public, max-age=60",
+		"/git.x/some/@latest":                "public, max-age=60",
+		"/git.x/some/@v/master.info":         "public, max-age=60",
+		"/git.x/some/@v/none.info":           "public, max-age=60",
+		"/git.x/some/@v/v1.0.0.info":         "public, max-age=86400, immutable",
+		"/git.x/some/@v/v1.0.0.mod":          "public, max-age=86400, immutable",
+		"/git.x/some/@v/v1.0.0.zip":          "public, max-age=86400, immutable",
+		"/git.x/some/@v/v1.0.mod":            "public, max-age=60",
+		"/sumdb/sum.x/lookup/git.x/a@v1.0.0": "public, max-age=60",
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, cache, w.Header().Get("Cache-Control"), path)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/v1.0.0.info", nil))
+	assert.Equal(t, "Sun, 10 Oct 2021 10:10:10 GMT", w.Header().Get("Last-Modified"))
+
+	s.Cache.Negative = 0
+	s.Cache.Cmd[CmdList] = 5
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/none.info", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "must-revalidate, no-cache, no-store", w.Header().Get("Cache-Control"))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/list", nil))
+	assert.Equal(t, "public, max-age=5", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,303 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var errRecordNotFound = errors.New("record not found")
+
+// GenerateCheckSumKey generate a signer key and a verifier key of checksum database with name.
+// the verifier key is used by client as GOSUMDB=$vkey .
+func GenerateCheckSumKey(name string) (skey, vkey string, err error) {
+	return note.GenerateKey(rand.Reader, name)
+}
+
+// CheckSumResolverLocal is a private checksum database of modules served by a Resolver.
+// h1: hashes of .mod and .zip are computed when a module version is first looked up, appended to a
+// transparent log (merkle tree), and tree heads are signed with the signer key.
+// records are persisted to Dir (if not empty) and replayed on creation, so the log is append-only across restarts.
+type CheckSumResolverLocal struct {
+	//source of .mod and .zip
+	Resolver Resolver
+	//directory to persist records, empty for memory only
+	Dir     string
+	signer  note.Signer
+	lock    sync.Mutex
+	records [][]byte
+	hashes  []tlog.Hash
+	index   map[string]int64
+	signed  []byte
+}
+
+// create with a signer key @see GenerateCheckSumKey
+func NewCheckSumResolverLocal(skey string, resolver Resolver, dir string) (*CheckSumResolverLocal, error) {
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		return nil, err
+	}
+	c := &CheckSumResolverLocal{Resolver: resolver, Dir: dir, signer: signer, index: make(map[string]int64)}
+	if err = c.load(); err != nil {
+		return nil, err
+	}
+	if err = c.sign(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// name of checksum database, as the name of signer key
+func (c *CheckSumResolverLocal) Name() string {
+	return c.signer.Name()
+}
+
+func (c *CheckSumResolverLocal) recordFile() string {
+	return filepath.Join(c.Dir, "records")
+}
+
+//replay persisted records, each record is terminated by a blank line
+func (c *CheckSumResolverLocal) load() error {
+	if c.Dir == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(c.recordFile())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	size := int64(len(b))
+	for len(b) > 0 {
+		i := bytes.Index(b, []byte("\n\n"))
+		if i < 0 {
+			//a partial write of last record, dropped before any record appended after it
+			return os.Truncate(c.recordFile(), size-int64(len(b)))
+		}
+		if err = c.append(b[:i+1]); err != nil {
+			return err
+		}
+		b = b[i+2:]
+	}
+	return nil
+}
+
+func (c *CheckSumResolverLocal) readHashes(indexes []int64) ([]tlog.Hash, error) {
+	h := make([]tlog.Hash, len(indexes))
+	for i, x := range indexes {
+		if x < 0 || x >= int64(len(c.hashes)) {
+			return nil, fmt.Errorf("hash %d not in tree", x)
+		}
+		h[i] = c.hashes[x]
+	}
+	return h, nil
+}
+
+//append a record to tree in memory
+func (c *CheckSumResolverLocal) append(text []byte) error {
+	id := int64(len(c.records))
+	h, err := tlog.StoredHashes(id, text, tlog.HashReaderFunc(c.readHashes))
+	if err != nil {
+		return err
+	}
+	c.hashes = append(c.hashes, h...)
+	c.records = append(c.records, text)
+	for _, line := range strings.Split(strings.TrimSuffix(string(text), "\n"), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 3 && !strings.HasSuffix(f[1], "/go.mod") {
+			c.index[f[0]+"@"+f[1]] = id
+		}
+	}
+	return nil
+}
+
+//sign current tree head
+func (c *CheckSumResolverLocal) sign() error {
+	n := int64(len(c.records))
+	h, err := tlog.TreeHash(n, tlog.HashReaderFunc(c.readHashes))
+	if err != nil {
+		return err
+	}
+	signed, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: h}))}, c.signer)
+	if err != nil {
+		return err
+	}
+	c.signed = signed
+	return nil
+}
+
+// Record a module version into the log if absent, returns the record id.
+func (c *CheckSumResolverLocal) Record(module Module, version Version) (int64, error) {
+	key := string(module) + "@" + string(version)
+	c.lock.Lock()
+	id, ok := c.index[key]
+	c.lock.Unlock()
+	if ok {
+		return id, nil
+	}
+	if !semver.IsValid(string(version)) {
+		return 0, errRecordNotFound
+	}
+	text, err := c.hash(module, version)
+	if err != nil {
+		return 0, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if id, ok = c.index[key]; ok {
+		return id, nil
+	}
+	if c.Dir != "" {
+		if err = c.persist(text); err != nil {
+			return 0, err
+		}
+	}
+	if err = c.append(text); err != nil {
+		return 0, err
+	}
+	if err = c.sign(); err != nil {
+		return 0, err
+	}
+	return c.index[key], nil
+}
+
+func (c *CheckSumResolverLocal) persist(text []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.recordFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(append([]byte(nil), text...), '\n'))
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+//record text of module version: h1: hashes of zip and go.mod
+func (c *CheckSumResolverLocal) hash(module Module, version Version) ([]byte, error) {
+	mod := c.Resolver.Mod(module, version)
+	if mod == "" {
+		return nil, errRecordNotFound
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(string(mod))), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	z := c.Resolver.Zip(module, version)
+	if z == nil {
+		return nil, errRecordNotFound
+	}
+	zipHash, err := hashZip(z)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", module, version, zipHash, module, version, modHash)), nil
+}
+
+//h1: hash of a zip stream, the zip is closed
+func hashZip(z GoZip) (string, error) {
+	defer z.Close()
+	f, err := ioutil.TempFile("", "temp_zip_*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, z)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return "", err
+	}
+	return dirhash.HashZip(f.Name(), dirhash.Hash1)
+}
+
+func (c *CheckSumResolverLocal) Supported() bool {
+	return true
+}
+
+//the signed tree head
+func (c *CheckSumResolverLocal) Latest() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.signed
+}
+
+//record of module version and the signed tree head, the module version is recorded if absent
+func (c *CheckSumResolverLocal) Lookup(module Module, version Version) []byte {
+	id, err := c.Record(module, version)
+	if err != nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	msg, err := tlog.FormatRecord(id, c.records[id])
+	if err != nil {
+		return nil
+	}
+	return append(msg, c.signed...)
+}
+
+//hash tiles and data tiles ($H/data/$K[.p/$W]) of current tree
+func (c *CheckSumResolverLocal) Tile(path string) []byte {
+	t, err := tlog.ParseTilePath(SumTilePrefix + path)
+	if err != nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if t.L >= 0 {
+		b, err := tlog.ReadTileData(t, tlog.HashReaderFunc(c.readHashes))
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	start := t.N << uint(t.H)
+	if start+int64(t.W) > int64(len(c.records)) {
+		return nil
+	}
+	var data []byte
+	for i := start; i < start+int64(t.W); i++ {
+		msg, err := tlog.FormatRecord(i, c.records[i])
+		if err != nil {
+			return nil
+		}
+		data = append(data, msg...)
+	}
+	return data
+}
@@ -0,0 +1,198 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//a resolver serves every version of any module
+type zipResolver struct {
+}
+
+func (z zipResolver) Versions(Module) Versions {
+	return nil
+}
+
+func (z zipResolver) Info(Module, Version) *Info {
+	return nil
+}
+
+func (z zipResolver) Mod(module Module, _ Version) GoMod {
+	return GoMod("module " + module + "\n")
+}
+
+func (z zipResolver) Zip(module Module, version Version) GoZip {
+	b := new(bytes.Buffer)
+	w := zip.NewWriter(b)
+	f, _ := w.Create(string(module) + "@" + string(version) + "/go.mod")
+	_, _ = f.Write([]byte("module " + module + "\n"))
+	_ = w.Close()
+	return ioutil.NopCloser(b)
+}
+
+//sumdb client operations served by a CheckSumResolver
+type testClientOps struct {
+	db     CheckSumResolver
+	key    string
+	lock   sync.Mutex
+	config map[string][]byte
+}
+
+func (o *testClientOps) ReadRemote(path string) ([]byte, error) {
+	var b []byte
+	switch {
+	case path == "/latest":
+		b = o.db.Latest()
+	case strings.HasPrefix(path, "/lookup/"):
+		i := strings.LastIndex(path, "@")
+		m, err := module.UnescapePath(path[len("/lookup/"):i])
+		if err != nil {
+			return nil, err
+		}
+		b = o.db.Lookup(Module(m), Version(path[i+1:]))
+	case strings.HasPrefix(path, "/tile/"):
+		b = o.db.Tile(strings.TrimPrefix(path, "/tile/"))
+	}
+	if b == nil {
+		return nil, fmt.Errorf("not found: %s", path)
+	}
+	return b, nil
+}
+
+func (o *testClientOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.config[file], nil
+}
+
+func (o *testClientOps) WriteConfig(file string, old, new []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *testClientOps) ReadCache(string) ([]byte, error) {
+	return nil, fmt.Errorf("no cache")
+}
+
+func (o *testClientOps) WriteCache(string, []byte) {
+}
+
+func (o *testClientOps) Log(string) {
+}
+
+func (o *testClientOps) SecurityError(msg string) {
+	panic(msg)
+}
+
+func newTestClient(db CheckSumResolver, vkey string) *sumdb.Client {
+	return sumdb.NewClient(&testClientOps{db: db, key: vkey, config: make(map[string][]byte)})
+}
+
+func TestCheckSumResolverLocal(t *testing.T) {
+	skey, vkey, err := GenerateCheckSumKey("sum.git.x")
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := NewCheckSumResolverLocal(skey, zipResolver{}, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "sum.git.x", db.Name())
+	assert.True(t, db.Supported())
+	assert.Contains(t, string(db.Latest()), "go.sum database tree\n0\n")
+
+	c := newTestClient(db, vkey)
+	lines, err := c.Lookup("git.x/Some", "v1.0.0")
+	assert.Nil(t, err)
+	if assert.Len(t, lines, 1) {
+		assert.True(t, strings.HasPrefix(lines[0], "git.x/Some v1.0.0 h1:"))
+	}
+	mod, err := c.Lookup("git.x/Some", "v1.0.0/go.mod")
+	assert.Nil(t, err)
+	if assert.Len(t, mod, 1) {
+		assert.True(t, strings.HasPrefix(mod[0], "git.x/Some v1.0.0/go.mod h1:"))
+	}
+	for i := 1; i <= 300; i++ {
+		_, err = db.Record("git.x/some", Version(fmt.Sprintf("v1.0.%d", i)))
+		assert.Nil(t, err)
+	}
+	lines2, err := c.Lookup("git.x/some", "v1.0.300")
+	assert.Nil(t, err)
+	assert.Len(t, lines2, 1)
+	assert.Contains(t, string(db.Latest()), "go.sum database tree\n301\n")
+
+	//not canonical
+	_, err = db.Record("git.x/some", "master")
+	assert.NotNil(t, err)
+	assert.Nil(t, db.Lookup("git.x/some", "master"))
+
+	//replay
+	db, err = NewCheckSumResolverLocal(skey, zipResolver{}, dir)
+	assert.Nil(t, err)
+	assert.Contains(t, string(db.Latest()), "go.sum database tree\n301\n")
+	c = newTestClient(db, vkey)
+	again, err := c.Lookup("git.x/Some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, lines, again)
+	assert.Contains(t, string(db.Latest()), "go.sum database tree\n301\n")
+
+	//replay a partial write of last record
+	f, err := os.OpenFile(filepath.Join(dir, "records"), os.O_WRONLY|os.O_APPEND, 0644)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = f.WriteString("git.x/some v1.0.301 h1:")
+	assert.Nil(t, f.Close())
+	assert.Nil(t, err)
+	db, err = NewCheckSumResolverLocal(skey, zipResolver{}, dir)
+	assert.Nil(t, err)
+	assert.Contains(t, string(db.Latest()), "go.sum database tree\n301\n")
+	_, err = db.Record("git.x/some", "v1.0.301")
+	assert.Nil(t, err)
+	latest := db.Latest()
+	assert.Contains(t, string(latest), "go.sum database tree\n302\n")
+	db, err = NewCheckSumResolverLocal(skey, zipResolver{}, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, string(latest), string(db.Latest()))
+	c = newTestClient(db, vkey)
+	lines3, err := c.Lookup("git.x/some", "v1.0.301")
+	assert.Nil(t, err)
+	assert.Len(t, lines3, 1)
+}
@@ -0,0 +1,184 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"container/list"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckSumResolverProxy forward sumdb commands to an upstream checksum database.
+// tiles are immutable and cached in a LRU limited by TileBytes, latest and supported are cached for LatestAge.
+type CheckSumResolverProxy struct {
+	//upstream checksum database url, eg: https://sum.golang.org
+	Upstream string
+	Client   *http.Client
+	//how long the latest and supported are cached
+	LatestAge time.Duration
+	//max total bytes of cached tiles
+	TileBytes   int64
+	lock        sync.Mutex
+	tiles       map[string]*list.Element
+	tileLRU     *list.List
+	tileSize    int64
+	latest      []byte
+	latestAt    time.Time
+	supported   bool
+	supportedAt time.Time
+}
+
+type cachedTile struct {
+	path string
+	data []byte
+}
+
+//default max total bytes of cached tiles of CheckSumResolverProxy
+const DefaultTileBytes = 32 << 20
+
+//timeout of requests to upstream by the default client of CheckSumResolverProxy
+const DefaultCheckSumTimeout = 30 * time.Second
+
+// use a client with DefaultCheckSumTimeout when client is nil, so a stalled upstream never blocks forever.
+func NewCheckSumResolverProxy(upstream string, client *http.Client) *CheckSumResolverProxy {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultCheckSumTimeout}
+	}
+	return &CheckSumResolverProxy{
+		Upstream:  strings.TrimSuffix(upstream, "/"),
+		Client:    client,
+		LatestAge: time.Minute,
+		TileBytes: DefaultTileBytes,
+	}
+}
+
+//fetch from upstream, nil if not 200
+func (c *CheckSumResolverProxy) fetch(cmd SumCmd, module Module, version Version, param string) []byte {
+	u := BuildSumCmd(c.Upstream, cmd, module, version, param)
+	if u == "" {
+		return nil
+	}
+	res, err := c.Client.Get(u)
+	if err != nil {
+		return nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+//supported if upstream supported, or upstream is a checksum database itself
+func (c *CheckSumResolverProxy) Supported() bool {
+	c.lock.Lock()
+	if !c.supportedAt.IsZero() && time.Since(c.supportedAt) < c.LatestAge {
+		b := c.supported
+		c.lock.Unlock()
+		return b
+	}
+	c.lock.Unlock()
+	b := c.fetch(SumSupported, UndefinedModule, UndefinedVersion, "") != nil || c.Latest() != nil
+	c.lock.Lock()
+	c.supported = b
+	c.supportedAt = time.Now()
+	c.lock.Unlock()
+	return b
+}
+
+func (c *CheckSumResolverProxy) Latest() []byte {
+	c.lock.Lock()
+	if c.latest != nil && time.Since(c.latestAt) < c.LatestAge {
+		b := c.latest
+		c.lock.Unlock()
+		return b
+	}
+	c.lock.Unlock()
+	b := c.fetch(SumLatest, UndefinedModule, UndefinedVersion, "")
+	if b == nil {
+		return nil
+	}
+	c.lock.Lock()
+	c.latest = b
+	c.latestAt = time.Now()
+	c.lock.Unlock()
+	return b
+}
+
+func (c *CheckSumResolverProxy) Lookup(module Module, version Version) []byte {
+	return c.fetch(SumLookup, module, version, "")
+}
+
+func (c *CheckSumResolverProxy) Tile(path string) []byte {
+	if b := c.cachedTile(path); b != nil {
+		return b
+	}
+	b := c.fetch(SumTile, UndefinedModule, UndefinedVersion, path)
+	if b == nil {
+		return nil
+	}
+	c.cacheTile(path, b)
+	return b
+}
+
+func (c *CheckSumResolverProxy) cachedTile(path string) []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.tiles[path]
+	if !ok {
+		return nil
+	}
+	c.tileLRU.MoveToFront(e)
+	return e.Value.(*cachedTile).data
+}
+
+//cache a tile, least recently used tiles are evicted when TileBytes exceeded
+func (c *CheckSumResolverProxy) cacheTile(path string, data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.tiles == nil {
+		c.tiles = make(map[string]*list.Element)
+		c.tileLRU = list.New()
+	}
+	if e, ok := c.tiles[path]; ok {
+		c.removeTile(e)
+	}
+	size := int64(len(data))
+	if size > c.TileBytes {
+		return
+	}
+	c.tiles[path] = c.tileLRU.PushFront(&cachedTile{path, data})
+	c.tileSize += size
+	for c.tileSize > c.TileBytes {
+		c.removeTile(c.tileLRU.Back())
+	}
+}
+
+func (c *CheckSumResolverProxy) removeTile(e *list.Element) {
+	t := c.tileLRU.Remove(e).(*cachedTile)
+	delete(c.tiles, t.path)
+	c.tileSize -= int64(len(t.data))
+}
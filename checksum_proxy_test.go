@@ -0,0 +1,101 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckSumResolverProxy(t *testing.T) {
+	var latest, tiles, supported int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/supported", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&supported, 1)
+	})
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&latest, 1)
+		_, _ = w.Write([]byte("go.sum database tree\n1\n"))
+	})
+	mux.HandleFunc("/lookup/git.x/some@v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("1\ngit.x/some v1.0.0 h1:x=\n"))
+	})
+	mux.HandleFunc("/tile/8/0/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/001") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&tiles, 1)
+		_, _ = w.Write([]byte("TILE"))
+	})
+	up := httptest.NewServer(mux)
+	defer up.Close()
+
+	c := NewCheckSumResolverProxy(up.URL+"/", nil)
+	assert.True(t, c.Supported())
+	assert.True(t, c.Supported())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&supported))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "go.sum database tree\n1\n", string(c.Latest()))
+		assert.Equal(t, "TILE", string(c.Tile("8/0/000")))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&latest))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tiles))
+	assert.Equal(t, "1\ngit.x/some v1.0.0 h1:x=\n", string(c.Lookup("git.x/some", "v1.0.0")))
+	assert.Nil(t, c.Lookup("git.x/some", "v1.1.0"))
+	assert.Nil(t, c.Tile("8/0/001"))
+
+	//tiles are evicted by LRU
+	c.TileBytes = 8
+	c.Tile("8/0/002")
+	c.Tile("8/0/000")
+	c.Tile("8/0/003")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tiles))
+	c.Tile("8/0/000")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tiles))
+	c.Tile("8/0/002")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&tiles))
+	assert.Equal(t, int64(8), c.tileSize)
+
+	//latest expires
+	c.LatestAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	c.Latest()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&latest))
+
+	down := NewCheckSumResolverProxy("http://127.0.0.1:1", nil)
+	assert.False(t, down.Supported())
+
+	//a stalled upstream times out
+	stop := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stop
+	}))
+	defer stalled.Close()
+	defer close(stop)
+	c = NewCheckSumResolverProxy(stalled.URL, nil)
+	assert.Equal(t, DefaultCheckSumTimeout, c.Client.Timeout)
+	c.Client.Timeout = 50 * time.Millisecond
+	assert.Nil(t, c.Latest())
+}
@@ -0,0 +1,270 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+//a call in flight
+type flight struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	//waiters joined and gave up, guarded by lock of group
+	waiters int
+	left    int
+	//values shared to waiters when done
+	values []interface{}
+	err    error
+}
+
+//flightGroup coalesce concurrent calls of same key into one call
+type flightGroup struct {
+	lock    sync.Mutex
+	flights map[string]*flight
+}
+
+//key of a resolution
+func flightKey(cmd Cmd, module Module, version Version) string {
+	return fmt.Sprintf("%d %s@%s", cmd, module, version)
+}
+
+// do call fn once for concurrent calls with same key. fn is called with a context which is canceled only when all callers gave up.
+// when done, share make a value for each of n waiting callers from the value of fn (n is never less than 1), it takes
+// the cancel of the context and must call it when the value is no more used (as a streaming zip is closed), else the
+// context is canceled as soon as fn returns. release is called for values not taken by callers which gave up,
+// both of share and release may be nil for immutable values.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error),
+	share func(v interface{}, n int, cancel context.CancelFunc) ([]interface{}, error), release func(interface{})) (interface{}, error) {
+	g.lock.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		fc, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go g.call(key, f, fc, fn, share, release)
+	}
+	f.waiters++
+	g.lock.Unlock()
+	select {
+	case <-f.done:
+		return g.take(f)
+	case <-ctx.Done():
+		g.lock.Lock()
+		select {
+		case <-f.done:
+			//a value is shared to this caller
+			g.lock.Unlock()
+			if v, err := g.take(f); err == nil && release != nil {
+				release(v)
+			}
+		default:
+			f.left++
+			if f.left == f.waiters {
+				//abandoned, later callers start a new call
+				if g.flights[key] == f {
+					delete(g.flights, key)
+				}
+				f.cancel()
+			}
+			g.lock.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (g *flightGroup) call(key string, f *flight, ctx context.Context, fn func(ctx context.Context) (interface{}, error),
+	share func(v interface{}, n int, cancel context.CancelFunc) ([]interface{}, error), release func(interface{})) {
+	v, err := fn(ctx)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	defer close(f.done)
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	n := f.waiters - f.left
+	switch {
+	case err != nil:
+		f.err = err
+		f.cancel()
+	case n == 0:
+		if release != nil {
+			release(v)
+		}
+		f.cancel()
+	case share == nil:
+		f.values = repeat(v, n)
+		f.cancel()
+	default:
+		f.values, f.err = share(v, n, f.cancel)
+	}
+}
+
+//take a shared value
+func (g *flightGroup) take(f *flight) (interface{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	v := f.values[len(f.values)-1]
+	f.values = f.values[:len(f.values)-1]
+	return v, nil
+}
+
+//n copies of an immutable value
+func repeat(v interface{}, n int) []interface{} {
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = v
+	}
+	return values
+}
+
+//region shared zip
+
+//share a zip to n callers: the zip is written to a temporary file, and each caller reads it's own handle of the file.
+//the file is removed when all handles are closed. a single caller reads the zip itself, which cancels the resolution when closed.
+func shareZip(v interface{}, n int, cancel context.CancelFunc) ([]interface{}, error) {
+	z, ok := v.(GoZip)
+	if !ok || z == nil {
+		cancel()
+		return repeat(v, n), nil
+	}
+	if n == 1 {
+		return []interface{}{ownZip(z, cancel)}, nil
+	}
+	defer cancel()
+	defer z.Close()
+	hash := ""
+	if h, ok := z.(ZipHasher); ok {
+		hash = h.Hash()
+	}
+	f, err := ioutil.TempFile("", "mpc_shared_*.zip")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, z)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	s := &sharedFile{path: f.Name(), refs: n}
+	values := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		h, err := os.Open(s.path)
+		if err != nil {
+			for _, value := range values {
+				_ = value.(GoZip).Close()
+			}
+			for ; i < n; i++ {
+				s.release()
+			}
+			return nil, err
+		}
+		values = append(values, &sharedZip{File: h, shared: s, hash: hash})
+	}
+	return values, nil
+}
+
+//a temporary file removed when all references are released
+type sharedFile struct {
+	lock sync.Mutex
+	path string
+	refs int
+}
+
+func (s *sharedFile) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.refs--; s.refs == 0 {
+		_ = os.Remove(s.path)
+	}
+}
+
+//a handle of shared zip file
+type sharedZip struct {
+	*os.File
+	shared *sharedFile
+	hash   string
+	once   sync.Once
+}
+
+func (z *sharedZip) Close() error {
+	err := z.File.Close()
+	z.once.Do(z.shared.release)
+	return err
+}
+
+func (z *sharedZip) Hash() string {
+	return z.hash
+}
+
+//a zip owns the context of it's resolution, which is canceled when the zip is closed.
+//Size and Hash are forwarded, as -1 and "" if not supported by the zip.
+type ownedZip struct {
+	GoZip
+	cancel context.CancelFunc
+}
+
+//a seekable ownedZip
+type ownedSeekZip struct {
+	*ownedZip
+	io.Seeker
+}
+
+func ownZip(z GoZip, cancel context.CancelFunc) GoZip {
+	o := &ownedZip{GoZip: z, cancel: cancel}
+	if s, ok := z.(io.Seeker); ok {
+		return ownedSeekZip{o, s}
+	}
+	return o
+}
+
+func (z *ownedZip) Close() error {
+	defer z.cancel()
+	return z.GoZip.Close()
+}
+
+func (z *ownedZip) Size() int64 {
+	if s, ok := z.GoZip.(ZipSizer); ok {
+		return s.Size()
+	}
+	return -1
+}
+
+func (z *ownedZip) Hash() string {
+	if h, ok := z.GoZip.(ZipHasher); ok {
+		return h.Hash()
+	}
+	return ""
+}
+
+//endregion
@@ -0,0 +1,136 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer_Coalesce(t *testing.T) {
+	ctx := context.Background()
+	var calls, closed int32
+	s := newStrategyServer(nil, delayedResolver{mod: "SOME ZIP", delay: 50 * time.Millisecond, calls: &calls, closed: &closed})
+
+	//mod
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+			assert.Nil(t, err)
+			assert.Equal(t, GoMod("SOME ZIP"), m)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	//zip is shared by a temporary file
+	zips := make(chan GoZip, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			z, err := s.ResolveZip(ctx, "git.x/some", "v1.0.0")
+			assert.Nil(t, err)
+			zips <- z
+		}()
+	}
+	wg.Wait()
+	close(zips)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed))
+	var path string
+	for z := range zips {
+		if f, ok := z.(*sharedZip); ok {
+			path = f.Name()
+		}
+		b, err := ioutil.ReadAll(z)
+		assert.Nil(t, err)
+		assert.Equal(t, "SOME ZIP", string(b))
+		assert.Nil(t, z.Close())
+	}
+	if assert.NotEqual(t, "", path) {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	//a canceled caller does not cancel others
+	canceled, cancel := context.WithCancel(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.ResolveMod(canceled, "git.x/some", "v1.0.0")
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go cancel()
+	m, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("SOME ZIP"), m)
+	assert.True(t, errors.Is(<-errs, context.Canceled))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	//disabled
+	s.Coalesce = false
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+//a single caller streams the zip of a slow upstream, which is not canceled after resolution
+func TestServer_CoalesceStream(t *testing.T) {
+	chunk := bytes.Repeat([]byte("z"), 64*1024)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 16; i++ {
+			_, _ = w.Write(chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer up.Close()
+	for _, strategy := range []*ParallelStrategy{nil, {Timeout: time.Minute}} {
+		s := NewServer("/", 60)
+		s.Strategy = strategy
+		assert.True(t, s.Coalesce)
+		assert.Nil(t, s.RegisterResolverV2("upstream", 0, UpstreamResolverFactory(up.URL, nil)))
+		s.Initial()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/slow/@v/v1.0.0.zip", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 16*len(chunk), w.Body.Len())
+	}
+}
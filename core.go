@@ -19,154 +19,122 @@
 package mpc
 
 import (
-	"errors"
-	"sort"
+	"context"
 )
 
-var (
-	names         = map[int]string{}
-	factories     = map[int]ResolverFactory{}
-	resolverIndex = make([]int, 0, 5)
-)
+// DefaultServer used by package level functions and GoProxyHandler
+var DefaultServer = NewServer("/", 86400)
 
 func RegisterResolver(name string, order int, factory ResolverFactory) error {
-	if _, ok := names[order]; ok {
-		return errors.New("order is already exists")
-	}
-	names[order] = name
-	factories[order] = factory
-	resolverIndex = append(resolverIndex, order)
-	return nil
-}
-
-var (
-	checksum      = map[int]CheckSumResolver{}
-	checkSumIndex = make([]int, 0, 5)
-)
+	return DefaultServer.RegisterResolver(name, order, factory)
+}
+
+func RegisterResolverV2(name string, order int, factory ResolverV2Factory) error {
+	return DefaultServer.RegisterResolverV2(name, order, factory)
+}
 
 func RegisterCheckSumResolver(order int, resolver CheckSumResolver) error {
-	if _, ok := checksum[order]; ok {
-		return errors.New("order is already exists")
-	}
-	checksum[order] = resolver
-	checkSumIndex = append(checkSumIndex, order)
-	return nil
+	return DefaultServer.RegisterCheckSumResolver(order, resolver)
+}
+
+func RegisterCheckSumResolverFor(name string, order int, resolver CheckSumResolver) error {
+	return DefaultServer.RegisterCheckSumResolverFor(name, order, resolver)
+}
+
+func SetResolverFilter(order int, filter ModuleFilter) error {
+	return DefaultServer.SetResolverFilter(order, filter)
+}
+
+func SetCheckSumResolverFilter(order int, filter ModuleFilter) error {
+	return DefaultServer.SetCheckSumResolverFilter(order, filter)
 }
 
 // prepare resolvers
 func Initial() {
-	sort.Ints(resolverIndex)
-	resolvers = make([]Resolver, 0, len(resolverIndex))
-	for _, index := range resolverIndex {
-		resolvers = append(resolvers, factories[index](resolvers...))
-	}
-	sort.Ints(checkSumIndex)
+	DefaultServer.Initial()
 }
 
 // sorted if after Initial.
 func ResolverNames() (r []string) {
-	r = make([]string, 0, len(resolverIndex))
-	for _, index := range resolverIndex {
-		r = append(r, names[index])
-	}
-	return
+	return DefaultServer.ResolverNames()
 }
 
 // sorted if after Initial.
 func ResolverFactories() (r []ResolverFactory) {
-	sort.Ints(resolverIndex)
-	r = make([]ResolverFactory, 0, len(resolverIndex))
-	for _, index := range resolverIndex {
-		r = append(r, factories[index])
-	}
-	return
+	return DefaultServer.ResolverFactories()
 }
 
-var (
-	resolvers []Resolver
-)
-
 // nil if before Initial.
 func Resolvers() (r []Resolver) {
-	return resolvers
+	return DefaultServer.Resolvers()
+}
+
+// nil if before Initial.
+func ResolversV2() (r []ResolverV2) {
+	return DefaultServer.ResolversV2()
 }
 
 //fetch the Versions of module, if UNKNOWN just return nil
 func ResolveVersions(module Module) Versions {
-	for _, resolver := range resolvers {
-		if v := resolver.Versions(module); v != "" {
-			return v
-		}
-	}
-	return ""
+	v, _ := DefaultServer.ResolveVersions(context.Background(), module)
+	return v
+}
+
+//fetch the Versions of module @see ResolverV2
+func ResolveVersionsContext(ctx context.Context, module Module) (Versions, error) {
+	return DefaultServer.ResolveVersions(ctx, module)
 }
 
 // fetch the Info of a module with version, if UNKNOWN just return nil
 // version may is Latest
 func ResolveInfo(module Module, version Version) *Info {
-	for _, resolver := range resolvers {
-		if v := resolver.Info(module, version); v != nil {
-			return v
-		}
-	}
-	return nil
+	v, _ := DefaultServer.ResolveInfo(context.Background(), module, version)
+	return v
+}
+
+// fetch the Info of a module with version @see ResolverV2
+func ResolveInfoContext(ctx context.Context, module Module, version Version) (*Info, error) {
+	return DefaultServer.ResolveInfo(ctx, module, version)
 }
 
 // fetch the GoMod of a module with version, if UNKNOWN just return empty
 func ResolveMod(module Module, version Version) GoMod {
-	for _, resolver := range resolvers {
-		if v := resolver.Mod(module, version); v != "" {
-			return v
-		}
-	}
-	return ""
+	v, _ := DefaultServer.ResolveMod(context.Background(), module, version)
+	return v
+}
+
+// fetch the GoMod of a module with version @see ResolverV2
+func ResolveModContext(ctx context.Context, module Module, version Version) (GoMod, error) {
+	return DefaultServer.ResolveMod(ctx, module, version)
 }
 
 // fetch the GoZip of a module with version, if UNKNOWN just return nil
 func ResolveZip(module Module, version Version) GoZip {
-	for _, resolver := range resolvers {
-		if v := resolver.Zip(module, version); v != nil {
-			return v
-		}
-	}
-	return nil
+	v, _ := DefaultServer.ResolveZip(context.Background(), module, version)
+	return v
+}
+
+// fetch the GoZip of a module with version @see ResolverV2
+func ResolveZipContext(ctx context.Context, module Module, version Version) (GoZip, error) {
+	return DefaultServer.ResolveZip(ctx, module, version)
 }
 
+// of any checksum database
 func SumResolveSupported() bool {
-	for _, r := range checkSumIndex {
-		if checksum[r].Supported() {
-			return true
-		}
-	}
-	return false
+	return DefaultServer.SumResolveSupported("")
 }
 
 //$base/latest
 func SumResolveLatest() []byte {
-	for _, r := range checkSumIndex {
-		if m := checksum[r].Latest(); m != nil {
-			return m
-		}
-	}
-	return nil
+	return DefaultServer.SumResolveLatest("")
 }
 
 //$base/lookup/$module@$version
 func SumResolveLookup(module Module, version Version) []byte {
-	for _, r := range checkSumIndex {
-		if m := checksum[r].Lookup(module, version); m != nil {
-			return m
-		}
-	}
-	return nil
+	return DefaultServer.SumResolveLookup("", module, version)
 }
 
 //$base/tile/$H/$L/$K[.p/$W]  also process tile data $base/tile/$H/data/$K[.p/$W]
 func SumResolveTile(path string) []byte {
-	for _, r := range checkSumIndex {
-		if m := checksum[r].Tile(path); m != nil {
-			return m
-		}
-	}
-	return nil
+	return DefaultServer.SumResolveTile("", path)
 }
@@ -29,7 +29,7 @@ import (
 type JustTestResolver int
 
 func (j JustTestResolver) Versions(module Module) Versions {
-	return "1\n2\n3"
+	return Versions{"1", "2", "3"}
 }
 
 func (j JustTestResolver) Info(module Module, version Version) *Info {
@@ -19,10 +19,16 @@
 package mpc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/tlog"
 	"io"
 	"path"
+	"sort"
 	"strings"
 	"time"
 )
@@ -39,7 +45,55 @@ const LatestVersion Version = "latest"
 const UndefinedVersion Version = ""
 
 // for $base/$module/@v/list
-type Versions string
+type Versions []Version
+
+// ParseVersions parse a list of versions, one version per line, empty lines are ignored. nil if no version.
+func ParseVersions(text string) Versions {
+	var v Versions
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			v = append(v, Version(line))
+		}
+	}
+	return v
+}
+
+// String one version per line
+func (v Versions) String() string {
+	b := new(strings.Builder)
+	for i, version := range v {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(string(version))
+	}
+	return b.String()
+}
+
+// Sort versions by semantic version, invalid versions are ahead of valid ones.
+func (v Versions) Sort() {
+	sort.SliceStable(v, func(i, j int) bool {
+		return semver.Compare(string(v[i]), string(v[j])) < 0
+	})
+}
+
+// MergeVersions union lists of versions as a list response of protocol:
+// versions are de-duplicated and sorted, pseudo-versions are excluded. nil if no version.
+func MergeVersions(lists ...Versions) Versions {
+	var merged Versions
+	seen := map[Version]bool{}
+	for _, list := range lists {
+		for _, version := range list {
+			if seen[version] || IsPseudoVersion(version) {
+				continue
+			}
+			seen[version] = true
+			merged = append(merged, version)
+		}
+	}
+	merged.Sort()
+	return merged
+}
 
 // for $base/$module/@v/$version.info
 type Info struct {
@@ -59,10 +113,21 @@ func (i *Info) UnMarshal(b []byte) error {
 type GoMod string
 
 //for $base/$module/@v/$version.zip
+// a GoZip may implements io.Seeker for range requests, ZipSizer for Content-Length and ZipHasher for ETag.
 type GoZip interface {
 	io.ReadCloser
 }
 
+// ZipSizer is a GoZip knows it's size in bytes
+type ZipSizer interface {
+	Size() int64
+}
+
+// ZipHasher is a GoZip knows it's h1: hash (as go.sum)
+type ZipHasher interface {
+	Hash() string
+}
+
 // Resolver is a GO PROXY command processor
 // 1. can be a proxy to other GO Proxy server
 // 2. can be a local cache
@@ -82,6 +147,36 @@ type Resolver interface {
 // ResolverFactory
 type ResolverFactory func(resolvers ...Resolver) Resolver
 
+var (
+	//module or version is UNKNOWN, response as 404
+	ErrNotFound = errors.New("not found")
+	//module or version is removed or forbidden, response as 410
+	ErrGone = errors.New("gone")
+)
+
+// IsNotFound check if an error is (or wraps) ErrNotFound or ErrGone, other errors are considered as transient failures.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone)
+}
+
+// ResolverV2 is a Resolver can be canceled by context, and returns errors:
+// ErrNotFound or ErrGone (maybe wrapped) when the module or version is UNKNOWN, any other error is a transient failure.
+// @see UpgradeResolver and DowngradeResolver for adapting with Resolver.
+type ResolverV2 interface {
+	//fetch the Versions of module
+	Versions(ctx context.Context, module Module) (Versions, error)
+	// fetch the Info of a module with version
+	// version may is Latest
+	Info(ctx context.Context, module Module, version Version) (*Info, error)
+	// fetch the GoMod of a module with version
+	Mod(ctx context.Context, module Module, version Version) (GoMod, error)
+	// fetch the GoZip of a module with version
+	Zip(ctx context.Context, module Module, version Version) (GoZip, error)
+}
+
+// ResolverV2Factory
+type ResolverV2Factory func(resolvers ...ResolverV2) ResolverV2
+
 type Cmd int
 
 func (c Cmd) String() string {
@@ -133,7 +228,9 @@ const (
 	SumLatestSuffix    = "latest"
 	SumLookupPrefix    = "lookup/"
 	SumTilePrefix      = "tile/"
+)
 
+const (
 	SumUndefined SumCmd = iota
 	SumSupported
 	SumLatest
@@ -152,91 +249,191 @@ type CheckSumResolver interface {
 	Tile(path string) []byte
 }
 
-// parser a command
-// @parameter requestPath request url path without base part.
-// @return (Module , Version , Cmd , SumCmd,sum parameter)
-// Use Cmd and SumCmd to validate result.
-// sum parameter only for SumTile and SumTileData.
-// if is a Cmd: SumCmd is SumUndefined.
-// if is a SumCmd: Cmd is CmdUndefined.
-// if both Cmd is CmdUndefined and SumCmd is SumUndefined means the path can not be parsed.
+// ParseError is an invalid request path
+type ParseError struct {
+	Path   string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid request path %q: %s", e.Path, e.Reason)
+}
+
+// Request is a parsed request path, either a Cmd or a SumCmd
+type Request struct {
+	Module  Module
+	Version Version
+	Cmd     Cmd
+	SumCmd  SumCmd
+	//name of the checksum database of SumCmd, eg: sum.golang.org
+	SumDB string
+	//tile path of SumTile
+	Param string
+}
+
+// IsCanonicalVersion check if version is a canonical semantic version (maybe +incompatible), which is immutable.
+func IsCanonicalVersion(version Version) bool {
+	v := string(version)
+	return semver.IsValid(v) && (semver.Canonical(v) == v || semver.Canonical(v)+"+incompatible" == v)
+}
+
+// CommandParser parse a request path (without prefix), all results are undefined when the path is invalid.
+// the name of checksum database is only available from ParseRequest.
 func CommandParser(requestPath string) (m Module, v Version, c Cmd, s SumCmd, p string) {
-	req := path.Clean(requestPath)
-	if strings.HasPrefix(req, sumPrefix) {
-		return sumCmdProcessor(strings.TrimPrefix(req, sumPrefix))
+	r, err := ParseRequest(requestPath)
+	if err != nil {
+		return
+	}
+	return r.Module, r.Version, r.Cmd, r.SumCmd, r.Param
+}
+
+// ParseRequest parse a request path (without prefix) strictly:
+// the path must be clean (no '..', empty or trailing elements), module path and version must be valid case-encoded,
+// versions of .mod, .zip and checksum lookup must be canonical semantic versions, .info also accepts queries like branches.
+// checksum database commands are sumdb/$name/$command, as sumdb/sum.golang.org/lookup/$module@$version.
+func ParseRequest(requestPath string) (r Request, err error) {
+	if requestPath == "" || path.Clean(requestPath) != requestPath || strings.HasPrefix(requestPath, "/") {
+		return r, &ParseError{requestPath, "not a clean path"}
+	}
+	if strings.HasPrefix(requestPath, sumPrefix) {
+		ss := strings.SplitN(strings.TrimPrefix(requestPath, sumPrefix), "/", 2)
+		if len(ss) != 2 {
+			return r, &ParseError{requestPath, "checksum database command must be sumdb/$name/$command"}
+		}
+		r, err = parseSumCmd(ss[1])
+		r.SumDB = ss[0]
 	} else {
-		return cmdProcessor(req)
+		r, err = parseCmd(requestPath)
+	}
+	if err != nil {
+		return Request{}, &ParseError{requestPath, err.Error()}
 	}
+	return
 }
-func cmdProcessor(req string) (m Module, v Version, c Cmd, s SumCmd, p string) {
+
+func parseCmd(req string) (r Request, err error) {
+	var em, ev string
 	switch {
-	case strings.HasSuffix(req, "latest"): // $base/$module/@latest
-		v = LatestVersion
-		c = CmdLatest
-		m = Module(strings.TrimSuffix(req, "/@latest"))
+	case strings.HasSuffix(req, "/@latest"): // $base/$module/@latest
+		r.Cmd = CmdLatest
+		r.Version = LatestVersion
+		em = strings.TrimSuffix(req, "/@latest")
 	case strings.HasSuffix(req, "/@v/list"): // $base/$module/@v/list
-		v = UndefinedVersion
-		c = CmdList
-		m = Module(strings.TrimSuffix(req, "/@v/list"))
+		r.Cmd = CmdList
+		em = strings.TrimSuffix(req, "/@v/list")
 	case strings.HasSuffix(req, ".info"): //$base/$module/@v/$version.info
-		x := strings.TrimSuffix(req, ".info")
-		ss := strings.Split(x, "/@v/")
-		if len(ss) != 2 {
-			return
-		}
-		c = CmdInfo
-		v = Version(ss[1])
-		m = Module(ss[0])
+		r.Cmd = CmdInfo
+		em, ev = splitVersion(strings.TrimSuffix(req, ".info"))
 	case strings.HasSuffix(req, ".mod"): //$base/$module/@v/$version.mod
-		x := strings.TrimSuffix(req, ".mod")
-		ss := strings.Split(x, "/@v/")
-		if len(ss) != 2 {
-			return
-		}
-		c = CmdMod
-		v = Version(ss[1])
-		m = Module(ss[0])
+		r.Cmd = CmdMod
+		em, ev = splitVersion(strings.TrimSuffix(req, ".mod"))
 	case strings.HasSuffix(req, ".zip"): //$base/$module/@v/$version.zip
-		x := strings.TrimSuffix(req, ".zip")
-		ss := strings.Split(x, "/@v/")
-		if len(ss) != 2 {
+		r.Cmd = CmdZip
+		em, ev = splitVersion(strings.TrimSuffix(req, ".zip"))
+	default:
+		return r, errors.New("unknown command")
+	}
+	if r.Module, err = unescapeModule(em); err != nil {
+		return
+	}
+	if r.Cmd == CmdInfo || r.Cmd == CmdMod || r.Cmd == CmdZip {
+		if r.Version, err = unescapeVersion(ev); err != nil {
 			return
 		}
-		c = CmdZip
-		v = Version(ss[1])
-		m = Module(ss[0])
+		if r.Cmd != CmdInfo && !IsCanonicalVersion(r.Version) {
+			return r, fmt.Errorf("version %q is not canonical", r.Version)
+		}
 	}
 	return
 }
-func sumCmdProcessor(req string) (m Module, v Version, c Cmd, s SumCmd, p string) {
+
+//split $module/@v/$version, both are empty if not matched
+func splitVersion(req string) (string, string) {
+	ss := strings.Split(req, "/@v/")
+	if len(ss) != 2 {
+		return "", ""
+	}
+	return ss[0], ss[1]
+}
+
+func parseSumCmd(req string) (r Request, err error) {
 	switch {
-	case strings.HasSuffix(req, SumSupportedSuffix): //$base/supported
-		s = SumSupported
-		v = UndefinedVersion
-		m = UndefinedModule
-		p = ""
+	case req == SumSupportedSuffix: //$base/supported
+		r.SumCmd = SumSupported
 	case req == SumLatestSuffix: //$base/latest
-		s = SumLatest
-		v = UndefinedVersion
-		m = UndefinedModule
-		p = ""
+		r.SumCmd = SumLatest
 	case strings.HasPrefix(req, SumLookupPrefix): //$base/lookup/$module@$version
-		s = SumLookup
-		ss := strings.Split(strings.TrimPrefix(req, "lookup/"), "@")
+		r.SumCmd = SumLookup
+		ss := strings.Split(strings.TrimPrefix(req, SumLookupPrefix), "@")
 		if len(ss) != 2 {
+			return r, errors.New("lookup must be $module@$version")
+		}
+		if r.Module, err = unescapeModule(ss[0]); err != nil {
+			return
+		}
+		if r.Version, err = unescapeVersion(ss[1]); err != nil {
 			return
 		}
-		m = Module(ss[0])
-		v = Version(ss[1])
+		if !IsCanonicalVersion(r.Version) {
+			return r, fmt.Errorf("version %q is not canonical", r.Version)
+		}
 	case strings.HasPrefix(req, SumTilePrefix): //$base/tile/$H/$L/$K[.p/$W] or $base/tile/$H/data/$K[.p/$W]
-		s = SumTile
-		v = UndefinedVersion
-		m = UndefinedModule
-		p = strings.TrimPrefix(req, SumTilePrefix)
+		r.SumCmd = SumTile
+		if _, err = tlog.ParseTilePath(req); err != nil {
+			return
+		}
+		r.Param = strings.TrimPrefix(req, SumTilePrefix)
+	default:
+		return r, errors.New("unknown checksum database command")
 	}
 	return
 }
-func BuildCmd(proxy string, cmd Cmd, module Module, version Version) string {
+
+//decode a case-encoded module path ('!' + lower case for upper case), module path is checked
+func unescapeModule(escaped string) (Module, error) {
+	if escaped == "" {
+		return UndefinedModule, errors.New("empty module path")
+	}
+	m, err := module.UnescapePath(escaped)
+	if err != nil {
+		return UndefinedModule, err
+	}
+	return Module(m), nil
+}
+
+//decode a case-encoded version
+func unescapeVersion(escaped string) (Version, error) {
+	if escaped == "" {
+		return UndefinedVersion, errors.New("empty version")
+	}
+	v, err := module.UnescapeVersion(escaped)
+	if err != nil {
+		return UndefinedVersion, err
+	}
+	return Version(v), nil
+}
+
+//case-encode module and version, empty if invalid
+func escape(m Module, v Version) (string, string) {
+	em, err := module.EscapePath(string(m))
+	if err != nil {
+		return "", ""
+	}
+	if v == UndefinedVersion || v == LatestVersion {
+		return em, string(v)
+	}
+	ev, err := module.EscapeVersion(string(v))
+	if err != nil {
+		return "", ""
+	}
+	return em, ev
+}
+// BuildCmd build url of a command with case-encoded module and version, empty if module or version is invalid.
+func BuildCmd(proxy string, cmd Cmd, m Module, v Version) string {
+	module, version := escape(m, v)
+	if module == "" {
+		return ""
+	}
 	switch cmd {
 	case CmdLatest:
 		return fmt.Sprintf("%s/%s/@latest", proxy, module)
@@ -252,13 +449,18 @@ func BuildCmd(proxy string, cmd Cmd, module Module, version Version) string {
 		return ""
 	}
 }
-func BuildSumCmd(proxy string, cmd SumCmd, module Module, version Version, param string) string {
+// BuildSumCmd build url of a checksum database command, module and version are case-encoded for lookup.
+func BuildSumCmd(proxy string, cmd SumCmd, m Module, v Version, param string) string {
 	switch cmd {
 	case SumSupported:
 		return fmt.Sprintf("%s/supported", proxy)
 	case SumLatest:
 		return fmt.Sprintf("%s/latest", proxy)
 	case SumLookup:
+		module, version := escape(m, v)
+		if module == "" || version == "" {
+			return ""
+		}
 		return fmt.Sprintf("%s/lookup/%s@%s", proxy, module, version)
 	case SumTile:
 		return fmt.Sprintf("%s/tile/%s", proxy, param)
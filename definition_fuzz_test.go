@@ -0,0 +1,68 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"strings"
+	"testing"
+)
+
+//every accepted request path round-trips through BuildCmd or BuildSumCmd
+func FuzzParseRequest(f *testing.F) {
+	for _, p := range []string{
+		"github.com/!zen!liu!cn/mpc/@latest",
+		"github.com/!zen!liu!cn/mpc/@v/list",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2.info",
+		"github.com/!zen!liu!cn/mpc/@v/master.info",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2-!r!c.mod",
+		"github.com/!zen!liu!cn/mpc/v2/@v/v2.0.0-20211010101010-abcdefabcdef.zip",
+		"github.com/!zen!liu!cn/mpc/@v/v2.0.0+incompatible.zip",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2-latest.info",
+		"github.com/../mpc/@v/list",
+		"sumdb/sum.golang.org/supported",
+		"sumdb/sum.golang.org/latest",
+		"sumdb/sum.golang.org/lookup/github.com/!zen!liu!cn/mpc@v1.1.2",
+		"sumdb/sum.golang.org/tile/8/0/001",
+		"sumdb/sum.golang.org/tile/8/1/x001/002.p/5",
+		"sumdb/sum.golang.org/tile/8/data/003",
+	} {
+		f.Add(p)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		r, err := ParseRequest(p)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("%q: not a ParseError: %v", p, err)
+			}
+			return
+		}
+		var built string
+		if r.Cmd != CmdUndefined {
+			built = strings.TrimPrefix(BuildCmd("", r.Cmd, r.Module, r.Version), "/")
+		} else {
+			built = BuildSumCmd(sumPrefix+r.SumDB, r.SumCmd, r.Module, r.Version, r.Param)
+		}
+		if built != p {
+			t.Fatalf("%q: parsed as %+v, built as %q", p, r, built)
+		}
+	})
+}
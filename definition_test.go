@@ -18,7 +18,11 @@
 
 package mpc
 
-import "testing"
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
 
 func TestCommandParser(t *testing.T) {
 	type args struct {
@@ -35,7 +39,7 @@ func TestCommandParser(t *testing.T) {
 	}{
 		{
 			name:  "latestCmd",
-			args:  args{"github.com/ZenLiuCn/mpc/@latest"},
+			args:  args{"github.com/!zen!liu!cn/mpc/@latest"},
 			wantM: "github.com/ZenLiuCn/mpc",
 			wantV: LatestVersion,
 			wantC: CmdLatest,
@@ -44,7 +48,7 @@ func TestCommandParser(t *testing.T) {
 		},
 		{
 			name:  "listCmd",
-			args:  args{"github.com/ZenLiuCn/mpc/@v/list"},
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/list"},
 			wantM: "github.com/ZenLiuCn/mpc",
 			wantV: UndefinedVersion,
 			wantC: CmdList,
@@ -52,31 +56,71 @@ func TestCommandParser(t *testing.T) {
 			wantP: "",
 		}, {
 			name:  "infoCmd",
-			args:  args{"github.com/ZenLiuCn/mpc/@v/1.1.2.info"},
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/v1.1.2.info"},
 			wantM: "github.com/ZenLiuCn/mpc",
-			wantV: Version("1.1.2"),
+			wantV: Version("v1.1.2"),
 			wantC: CmdInfo,
 			wantS: 0,
 			wantP: "",
 		}, {
 			name:  "modCmd",
-			args:  args{"github.com/ZenLiuCn/mpc/@v/1.1.2.mod"},
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/v1.1.2.mod"},
 			wantM: "github.com/ZenLiuCn/mpc",
-			wantV: Version("1.1.2"),
+			wantV: Version("v1.1.2"),
 			wantC: CmdMod,
 			wantS: 0,
 			wantP: "",
 		}, {
 			name:  "zipCmd",
-			args:  args{"github.com/ZenLiuCn/mpc/@v/1.1.2.zip"},
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/v1.1.2.zip"},
 			wantM: "github.com/ZenLiuCn/mpc",
-			wantV: Version("1.1.2"),
+			wantV: Version("v1.1.2"),
 			wantC: CmdZip,
 			wantS: 0,
 			wantP: "",
+		}, {
+			name:  "upperVersion",
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/v1.1.2-!r!c.info"},
+			wantM: "github.com/ZenLiuCn/mpc",
+			wantV: Version("v1.1.2-RC"),
+			wantC: CmdInfo,
+			wantS: 0,
+			wantP: "",
+		}, {
+			name:  "notEscaped",
+			args:  args{"github.com/ZenLiuCn/mpc/@v/list"},
+			wantM: "",
+			wantV: "",
+			wantC: 0,
+			wantS: 0,
+			wantP: "",
+		}, {
+			name:  "invalidModule",
+			args:  args{"github.com/zen liu/mpc/@v/v1.1.2.mod"},
+			wantM: "",
+			wantV: "",
+			wantC: 0,
+			wantS: 0,
+			wantP: "",
+		}, {
+			name:  "latestLikeVersion",
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/v1.1.2-latest.info"},
+			wantM: "github.com/ZenLiuCn/mpc",
+			wantV: Version("v1.1.2-latest"),
+			wantC: CmdInfo,
+			wantS: 0,
+			wantP: "",
+		}, {
+			name:  "infoQuery",
+			args:  args{"github.com/!zen!liu!cn/mpc/@v/master.info"},
+			wantM: "github.com/ZenLiuCn/mpc",
+			wantV: Version("master"),
+			wantC: CmdInfo,
+			wantS: 0,
+			wantP: "",
 		}, {
 			name:  "latestSum",
-			args:  args{"sumdb/latest"},
+			args:  args{"sumdb/sum.golang.org/latest"},
 			wantM: "",
 			wantV: "",
 			wantC: 0,
@@ -84,44 +128,44 @@ func TestCommandParser(t *testing.T) {
 			wantP: "",
 		}, {
 			name:  "lookupSum",
-			args:  args{"sumdb/lookup/github.com/ZenLiuCn/mpc@1.1.2"},
+			args:  args{"sumdb/sum.golang.org/lookup/github.com/!zen!liu!cn/mpc@v1.1.2"},
 			wantM: "github.com/ZenLiuCn/mpc",
-			wantV: Version("1.1.2"),
+			wantV: Version("v1.1.2"),
 			wantC: 0,
 			wantS: SumLookup,
 			wantP: "",
 		}, {
 			name:  "tileSum1",
-			args:  args{"sumdb/tile/1/2/3"},
+			args:  args{"sumdb/sum.golang.org/tile/8/2/003"},
 			wantM: "",
 			wantV: "",
 			wantC: 0,
 			wantS: SumTile,
-			wantP: "1/2/3",
+			wantP: "8/2/003",
 		}, {
 			name:  "tileSum2",
-			args:  args{"sumdb/tile/1/2/3.p/4"},
+			args:  args{"sumdb/sum.golang.org/tile/8/2/003.p/4"},
 			wantM: "",
 			wantV: "",
 			wantC: 0,
 			wantS: SumTile,
-			wantP: "1/2/3.p/4",
+			wantP: "8/2/003.p/4",
 		}, {
 			name:  "tileDataSum1",
-			args:  args{"sumdb/tile/1/0/3.p/4"},
+			args:  args{"sumdb/sum.golang.org/tile/8/data/003.p/4"},
 			wantM: "",
 			wantV: "",
 			wantC: 0,
 			wantS: SumTile,
-			wantP: "1/0/3.p/4",
+			wantP: "8/data/003.p/4",
 		}, {
 			name:  "tileDataSum2",
-			args:  args{"sumdb/tile/1/0/3"},
+			args:  args{"sumdb/sum.golang.org/tile/8/data/003"},
 			wantM: "",
 			wantV: "",
 			wantC: 0,
 			wantS: SumTile,
-			wantP: "1/0/3",
+			wantP: "8/data/003",
 		},
 	}
 	for _, tt := range tests {
@@ -145,3 +189,71 @@ func TestCommandParser(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildCmd(t *testing.T) {
+	assert.Equal(t, "http://x/github.com/!zen!liu!cn/mpc/@latest", BuildCmd("http://x", CmdLatest, "github.com/ZenLiuCn/mpc", LatestVersion))
+	assert.Equal(t, "http://x/github.com/!zen!liu!cn/mpc/@v/list", BuildCmd("http://x", CmdList, "github.com/ZenLiuCn/mpc", UndefinedVersion))
+	assert.Equal(t, "http://x/github.com/!zen!liu!cn/mpc/@v/v1.0.0-!r!c.zip", BuildCmd("http://x", CmdZip, "github.com/ZenLiuCn/mpc", "v1.0.0-RC"))
+	assert.Equal(t, "", BuildCmd("http://x", CmdMod, "github.com/zen liu/mpc", "v1.0.0"))
+	assert.Equal(t, "http://x/lookup/github.com/!zen!liu!cn/mpc@v1.0.0", BuildSumCmd("http://x", SumLookup, "github.com/ZenLiuCn/mpc", "v1.0.0", ""))
+	assert.Equal(t, "http://x/tile/8/0/1", BuildSumCmd("http://x", SumTile, UndefinedModule, UndefinedVersion, "8/0/1"))
+	m, v, c, _, _ := CommandParser(strings.TrimPrefix(BuildCmd("", CmdInfo, "github.com/ZenLiuCn/mpc", "v1.0.0-RC"), "/"))
+	assert.Equal(t, Module("github.com/ZenLiuCn/mpc"), m)
+	assert.Equal(t, Version("v1.0.0-RC"), v)
+	assert.Equal(t, CmdInfo, c)
+}
+
+func TestParseRequest(t *testing.T) {
+	for _, p := range []string{
+		"",
+		"/github.com/!zen!liu!cn/mpc/@v/list",
+		"github.com/!zen!liu!cn/mpc/@v/list/",
+		"github.com/!zen!liu!cn/../mpc/@v/list",
+		"github.com//mpc/@v/list",
+		"github.com/!zen!liu!cn/mpc/latest",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.mod",
+		"github.com/!zen!liu!cn/mpc/@v/master.zip",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2+build.zip",
+		"github.com/!zen!liu!cn/mpc/@v/.info",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2/@v/v1.1.2.info",
+		"github.com/!zen!liu!cn/mpc/@v/v1.1.2:x.info",
+		"github.com/!zen!liu!cn/mpc/@v/x",
+		"@v/list",
+		"sumdb/sum.golang.org/lookup/github.com/!zen!liu!cn/mpc@master",
+		"sumdb/sum.golang.org/lookup/github.com/!zen!liu!cn/mpc",
+		"sumdb/sum.golang.org/tile/1/0/3.p/4",
+		"sumdb/sum.golang.org/tile/8/x/3",
+		"sumdb/sum.golang.org/other",
+		"sumdb/supported",
+		"sumdb/lookup/github.com/!zen!liu!cn/mpc@v1.1.2",
+	} {
+		_, err := ParseRequest(p)
+		if assert.NotNil(t, err, p) {
+			_, ok := err.(*ParseError)
+			assert.True(t, ok, p)
+		}
+	}
+	r, err := ParseRequest("github.com/!zen!liu!cn/mpc/@v/v2.0.0+incompatible.zip")
+	assert.Nil(t, err)
+	assert.Equal(t, Request{Module: "github.com/ZenLiuCn/mpc", Version: "v2.0.0+incompatible", Cmd: CmdZip}, r)
+	_, _, c, sc, _ := CommandParser("sumdb/other")
+	assert.Equal(t, CmdUndefined, c)
+	assert.Equal(t, SumUndefined, sc)
+	r, err = ParseRequest("sumdb/sum.x/lookup/git.x/some@v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, Request{Module: "git.x/some", Version: "v1.0.0", SumCmd: SumLookup, SumDB: "sum.x"}, r)
+}
+
+func TestMergeVersions(t *testing.T) {
+	assert.Nil(t, ParseVersions(" \n"))
+	v := ParseVersions("v1.1.0\nv1.0.0\r\n\n")
+	assert.Equal(t, Versions{"v1.1.0", "v1.0.0"}, v)
+	assert.Equal(t, "v1.1.0\nv1.0.0", v.String())
+	assert.Equal(t, Versions{"v1.0.0", "v1.0.1-rc.1", "v1.0.1", "v1.1.0", "v2.0.0+incompatible"}, MergeVersions(
+		v,
+		Versions{"v1.0.1", "v2.0.0+incompatible", "v1.1.0", "v1.0.2-0.20211010101010-abcdefabcdef"},
+		nil,
+		Versions{"v1.0.1-rc.1"},
+	))
+	assert.Nil(t, MergeVersions(Versions{"v0.0.0-20211010101010-abcdefabcdef"}))
+}
@@ -18,9 +18,22 @@
 
 package git
 
-import "github.com/ZenLiuCN/mpc"
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"github.com/ZenLiuCN/mpc"
+	"golang.org/x/mod/module"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
 
-// cache is a settable resolver
+// cache is a settable resolver.
+// SetZip must read and close the zip.
 type Cache interface {
 	SetVersions(module mpc.Module, versions mpc.Versions)
 	Versions(module mpc.Module) mpc.Versions
@@ -34,3 +47,294 @@ type Cache interface {
 	SetZip(module mpc.Module, version mpc.Version, zip mpc.GoZip)
 	Zip(module mpc.Module, version mpc.Version) mpc.GoZip
 }
+
+//region MemoryCache
+
+// MemoryCache is an in-memory LRU Cache limited by total bytes of entries
+type MemoryCache struct {
+	//max total bytes of entries, entry larger than it is never stored
+	MaxBytes int64
+	lock     sync.Mutex
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{MaxBytes: maxBytes, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *MemoryCache) get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.items == nil {
+		return nil, false
+	}
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (c *MemoryCache) set(key string, value interface{}, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.items == nil {
+		c.lru = list.New()
+		c.items = make(map[string]*list.Element)
+	}
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	if size > c.MaxBytes {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&memoryEntry{key: key, value: value, size: size})
+	c.size += size
+	for c.size > c.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MemoryCache) remove(e *list.Element) {
+	x := c.lru.Remove(e).(*memoryEntry)
+	delete(c.items, x.key)
+	c.size -= x.size
+}
+
+//current total bytes of entries
+func (c *MemoryCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size
+}
+
+func (c *MemoryCache) SetVersions(module mpc.Module, versions mpc.Versions) {
+	c.set("list:"+string(module), versions, int64(len(versions.String())))
+}
+
+func (c *MemoryCache) Versions(module mpc.Module) mpc.Versions {
+	if v, ok := c.get("list:" + string(module)); ok {
+		return v.(mpc.Versions)
+	}
+	return nil
+}
+
+func (c *MemoryCache) SetInfo(module mpc.Module, version mpc.Version, info *mpc.Info) {
+	b := info.Marshal()
+	c.set("info:"+string(module)+"@"+string(version), b, int64(len(b)))
+}
+
+func (c *MemoryCache) Info(module mpc.Module, version mpc.Version) *mpc.Info {
+	if v, ok := c.get("info:" + string(module) + "@" + string(version)); ok {
+		info := new(mpc.Info)
+		if info.UnMarshal(v.([]byte)) == nil {
+			return info
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) SetMod(module mpc.Module, version mpc.Version, mod mpc.GoMod) {
+	c.set("mod:"+string(module)+"@"+string(version), mod, int64(len(mod)))
+}
+
+func (c *MemoryCache) Mod(module mpc.Module, version mpc.Version) mpc.GoMod {
+	if v, ok := c.get("mod:" + string(module) + "@" + string(version)); ok {
+		return v.(mpc.GoMod)
+	}
+	return ""
+}
+
+//read and close the zip, zip larger than MaxBytes is discarded. the h1: hash is kept with the bytes
+func (c *MemoryCache) SetZip(module mpc.Module, version mpc.Version, zip mpc.GoZip) {
+	defer zip.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(zip, c.MaxBytes+1))
+	if err != nil || int64(len(b)) > c.MaxBytes {
+		return
+	}
+	hash := ""
+	if h, ok := zip.(mpc.ZipHasher); ok {
+		hash = h.Hash()
+	}
+	if hash == "" {
+		hash = hashZipBytes(b)
+	}
+	c.set("zip:"+string(module)+"@"+string(version), memoryZip{b, hash}, int64(len(b)))
+}
+
+func (c *MemoryCache) Zip(module mpc.Module, version mpc.Version) mpc.GoZip {
+	if v, ok := c.get("zip:" + string(module) + "@" + string(version)); ok {
+		z := v.(memoryZip)
+		return bytesZip{bytes.NewReader(z.data), z.hash}
+	}
+	return nil
+}
+
+//a cached zip with it's h1: hash
+type memoryZip struct {
+	data []byte
+	hash string
+}
+
+//a GoZip in memory, which knows it's h1: hash
+type bytesZip struct {
+	*bytes.Reader
+	hash string
+}
+
+func (b bytesZip) Close() error {
+	return nil
+}
+
+func (b bytesZip) Hash() string {
+	return b.hash
+}
+
+//endregion
+
+//region FileCache
+
+// FileCache is a Cache on file system, laid out as $GOMODCACHE/cache/download:
+// $Root/$module/@v/list, $Root/$module/@v/$version.info, $Root/$module/@v/$version.mod, $Root/$module/@v/$version.zip .
+// module and version are case escaped. so Root can be used as a GOPROXY=file:///$Root directly.
+type FileCache struct {
+	Root string
+}
+
+func NewFileCache(root string) *FileCache {
+	return &FileCache{Root: root}
+}
+
+//path of a cache file, empty if module or version is invalid
+func (c *FileCache) path(mod mpc.Module, version mpc.Version, suffix string) string {
+	m, err := module.EscapePath(string(mod))
+	if err != nil {
+		return ""
+	}
+	if version == mpc.UndefinedVersion {
+		return filepath.Join(c.Root, filepath.FromSlash(m), "@v", suffix)
+	}
+	v, err := module.EscapeVersion(string(version))
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(c.Root, filepath.FromSlash(m), "@v", v+suffix)
+}
+
+//write file atomically
+func (c *FileCache) write(file string, r io.Reader) {
+	if file == "" {
+		return
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(dir, ".tmp_*")
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(f, r)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+}
+
+func (c *FileCache) read(file string) []byte {
+	if file == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (c *FileCache) SetVersions(module mpc.Module, versions mpc.Versions) {
+	c.write(c.path(module, mpc.UndefinedVersion, "list"), bytes.NewBufferString(versions.String()))
+}
+
+func (c *FileCache) Versions(module mpc.Module) mpc.Versions {
+	return mpc.ParseVersions(string(c.read(c.path(module, mpc.UndefinedVersion, "list"))))
+}
+
+func (c *FileCache) SetInfo(module mpc.Module, version mpc.Version, info *mpc.Info) {
+	c.write(c.path(module, version, ".info"), bytes.NewReader(info.Marshal()))
+}
+
+func (c *FileCache) Info(module mpc.Module, version mpc.Version) *mpc.Info {
+	b := c.read(c.path(module, version, ".info"))
+	if b == nil {
+		return nil
+	}
+	info := new(mpc.Info)
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil
+	}
+	return info
+}
+
+func (c *FileCache) SetMod(module mpc.Module, version mpc.Version, mod mpc.GoMod) {
+	c.write(c.path(module, version, ".mod"), bytes.NewBufferString(string(mod)))
+}
+
+func (c *FileCache) Mod(module mpc.Module, version mpc.Version) mpc.GoMod {
+	return mpc.GoMod(c.read(c.path(module, version, ".mod")))
+}
+
+//read and close the zip, the h1: hash is kept in .ziphash as GOMODCACHE does
+func (c *FileCache) SetZip(module mpc.Module, version mpc.Version, zip mpc.GoZip) {
+	defer zip.Close()
+	file := c.path(module, version, ".zip")
+	if file == "" {
+		return
+	}
+	c.write(file, zip)
+	hash := ""
+	if h, ok := zip.(mpc.ZipHasher); ok {
+		hash = h.Hash()
+	}
+	if hash == "" {
+		hash = hashZip(file)
+	}
+	if hash != "" {
+		c.write(c.path(module, version, ".ziphash"), bytes.NewBufferString(hash))
+	}
+}
+
+func (c *FileCache) Zip(module mpc.Module, version mpc.Version) mpc.GoZip {
+	file := c.path(module, version, ".zip")
+	if file == "" {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	//zips cached without .ziphash are hashed once
+	hash := strings.TrimSpace(string(c.read(c.path(module, version, ".ziphash"))))
+	if hash == "" {
+		if hash = hashZip(file); hash != "" {
+			c.write(c.path(module, version, ".ziphash"), bytes.NewBufferString(hash))
+		}
+	}
+	return zipFile{f, hash}
+}
+
+//endregion
@@ -0,0 +1,168 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"bytes"
+	"github.com/ZenLiuCN/mpc"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCache(t *testing.T, c Cache) {
+	c.SetVersions("git.x/Some", mpc.Versions{"v1.0.0", "v1.1.0"})
+	assert.Equal(t, mpc.ParseVersions("v1.0.0\nv1.1.0"), c.Versions("git.x/Some"))
+	assert.Equal(t, mpc.Versions(nil), c.Versions("git.x/none"))
+
+	info := &mpc.Info{Version: "v1.0.0", Time: testTime}
+	c.SetInfo("git.x/Some", "v1.0.0", info)
+	assert.Equal(t, info, c.Info("git.x/Some", "v1.0.0"))
+	assert.Nil(t, c.Info("git.x/Some", "v1.1.0"))
+
+	c.SetMod("git.x/Some", "v1.0.0", "module git.x/Some\n")
+	assert.Equal(t, mpc.GoMod("module git.x/Some\n"), c.Mod("git.x/Some", "v1.0.0"))
+	assert.Equal(t, mpc.GoMod(""), c.Mod("git.x/Some", "v1.1.0"))
+
+	c.SetZip("git.x/Some", "v1.0.0", ioutil.NopCloser(bytes.NewBufferString("ZIP")))
+	z := c.Zip("git.x/Some", "v1.0.0")
+	if assert.NotNil(t, z) {
+		b, err := ioutil.ReadAll(z)
+		assert.Nil(t, err)
+		assert.Equal(t, "ZIP", string(b))
+		assert.Nil(t, z.Close())
+	}
+	assert.Nil(t, c.Zip("git.x/Some", "v1.1.0"))
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(1024)
+	testCache(t, c)
+
+	c = NewMemoryCache(10)
+	c.SetMod("a", "v1.0.0", "123456")
+	c.SetMod("b", "v1.0.0", "1234")
+	assert.Equal(t, int64(10), c.Size())
+	//touch a, then b is the least recently used
+	assert.Equal(t, mpc.GoMod("123456"), c.Mod("a", "v1.0.0"))
+	c.SetMod("c", "v1.0.0", "12")
+	assert.Equal(t, mpc.GoMod(""), c.Mod("b", "v1.0.0"))
+	assert.Equal(t, mpc.GoMod("123456"), c.Mod("a", "v1.0.0"))
+	assert.Equal(t, mpc.GoMod("12"), c.Mod("c", "v1.0.0"))
+	assert.Equal(t, int64(8), c.Size())
+	//too large
+	c.SetZip("a", "v1.0.0", ioutil.NopCloser(bytes.NewBufferString("12345678901")))
+	assert.Nil(t, c.Zip("a", "v1.0.0"))
+	assert.Equal(t, int64(8), c.Size())
+}
+
+//a zip knows it's hash
+type hashedZip struct {
+	io.ReadCloser
+	hash string
+}
+
+func (h hashedZip) Hash() string {
+	return h.hash
+}
+
+func TestMemoryCache_Hash(t *testing.T) {
+	c := NewMemoryCache(1 << 20)
+	c.SetZip("git.x/some", "v1.0.0", hashedZip{ioutil.NopCloser(bytes.NewBufferString("ZIP")), "h1:x="})
+	z := c.Zip("git.x/some", "v1.0.0")
+	if assert.Implements(t, (*mpc.ZipHasher)(nil), z) {
+		assert.Equal(t, "h1:x=", z.(mpc.ZipHasher).Hash())
+	}
+
+	//hash computed from the bytes
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module git.x/some\n"), 0644))
+	var b bytes.Buffer
+	assert.Nil(t, CreateModuleZip(&b, "git.x/some", "v1.0.1", dir))
+	file := filepath.Join(dir, "some.zip")
+	assert.Nil(t, ioutil.WriteFile(file, b.Bytes(), 0644))
+	want := hashZip(file)
+	assert.NotEqual(t, "", want)
+	assert.Equal(t, want, hashZipBytes(b.Bytes()))
+	c.SetZip("git.x/some", "v1.0.1", ioutil.NopCloser(&b))
+	z = c.Zip("git.x/some", "v1.0.1")
+	if assert.Implements(t, (*mpc.ZipHasher)(nil), z) {
+		assert.Equal(t, want, z.(mpc.ZipHasher).Hash())
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testCache(t, NewFileCache(dir))
+	for _, f := range []string{"list", "v1.0.0.info", "v1.0.0.mod", "v1.0.0.zip"} {
+		_, err := os.Stat(filepath.Join(dir, "git.x", "!some", "@v", f))
+		assert.Nil(t, err, f)
+	}
+}
+
+func TestResolver_Cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newTestRepo(t, dir, "some", testRevision{
+		files: map[string]string{"go.mod": "module git.x/some\n"},
+		tag:   "v1.0.0",
+		when:  testTime,
+	})
+	c := NewFileCache(filepath.Join(dir, "cache"))
+	s := NewResolver(nil, map[string]string{"git.x/": "file://" + dir + "/"}, c)
+	s.Pool = NewPool(filepath.Join(dir, "pool"), time.Minute)
+	assert.Equal(t, mpc.ParseVersions("v1.0.0"), s.Versions("git.x/some"))
+	assert.NotNil(t, s.Info("git.x/some", mpc.LatestVersion))
+	assert.Equal(t, mpc.GoMod("module git.x/some\n"), s.Mod("git.x/some", "v1.0.0"))
+	names := zipNames(t, s.Zip("git.x/some", "v1.0.0"))
+	assert.Equal(t, []string{"git.x/some@v1.0.0/go.mod"}, names)
+	hash, err := ioutil.ReadFile(filepath.Join(dir, "cache", "git.x", "some", "@v", "v1.0.0.ziphash"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "h1:"))
+
+	//repository is gone, cached results are served
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "some.git")))
+	s.Pool = NewPool(filepath.Join(dir, "pool2"), time.Minute)
+	assert.Equal(t, mpc.ParseVersions("v1.0.0"), s.Versions("git.x/some"))
+	assert.Equal(t, &mpc.Info{Version: "v1.0.0", Time: testTime}, s.Info("git.x/some", "v1.0.0"))
+	assert.Nil(t, s.Info("git.x/some", mpc.LatestVersion))
+	assert.Equal(t, mpc.GoMod("module git.x/some\n"), s.Mod("git.x/some", "v1.0.0"))
+	assert.Equal(t, names, zipNames(t, s.Zip("git.x/some", "v1.0.0")))
+	z := s.Zip("git.x/some", "v1.0.0")
+	if assert.NotNil(t, z) {
+		assert.Equal(t, string(hash), z.(mpc.ZipHasher).Hash())
+		assert.Nil(t, z.Close())
+	}
+}
@@ -20,21 +20,29 @@ package git
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
+	"github.com/ZenLiuCN/mpc"
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	ssh2 "golang.org/x/crypto/ssh"
+	modzip "golang.org/x/mod/zip"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
 )
 
+var ErrAmbiguousCommit = errors.New("ambiguous commit hash prefix")
+
 //region Git
 type Git struct {
 }
@@ -65,6 +73,30 @@ func (s *Git) Clone(url string, repoPath string, auth transport.AuthMethod) (rep
 	//re, err = git.PlainClone(dir, false, co)
 	return &Repo{Raw: re, Path: dir}, err
 }
+//mirror refspecs, all branches and tags are fetched as local references
+var mirrorRefSpecs = []config.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+//mirror a repository into dir as a bare repository @see Repo.Fetch
+func (s *Git) Mirror(url string, dir string, auth transport.AuthMethod) (repo *Repo, err error) {
+	return s.MirrorContext(context.Background(), url, dir, auth)
+}
+
+//mirror a repository into dir as a bare repository, the fetching is canceled by ctx @see Repo.FetchContext
+func (s *Git) MirrorContext(ctx context.Context, url string, dir string, auth transport.AuthMethod) (repo *Repo, err error) {
+	var re *git.Repository
+	if re, err = git.PlainInit(dir, true); err != nil {
+		return nil, err
+	}
+	_, err = re.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}, Fetch: mirrorRefSpecs})
+	if err != nil {
+		return nil, err
+	}
+	repo = &Repo{Raw: re, Path: dir}
+	if err = repo.FetchContext(ctx, auth); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
 func (s *Git) Open(path string) (repo *Repo, err error) {
 	var re *git.Repository
 	re, err = git.PlainOpen(path)
@@ -90,6 +122,8 @@ type Repo struct {
 	Path          string
 	br            []*Branch
 	currentBranch *Branch
+	//guard object storage reading, go-git storage is not safe for concurrent use
+	objects sync.Mutex
 }
 
 func (r *Repo) Pull(auth transport.AuthMethod) (err error) {
@@ -103,6 +137,71 @@ func (r *Repo) Pull(auth transport.AuthMethod) (err error) {
 	err = w.Pull(opt)
 	return
 }
+//fetch branches and tags from origin, HEAD of a bare mirror follows HEAD of origin.
+func (r *Repo) Fetch(auth transport.AuthMethod) (err error) {
+	return r.FetchContext(context.Background(), auth)
+}
+
+//fetch as Fetch, canceled by ctx
+func (r *Repo) FetchContext(ctx context.Context, auth transport.AuthMethod) (err error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	defer func() {
+		r.br = nil
+		r.currentBranch = nil
+	}()
+	opt := new(git.FetchOptions)
+	opt.RemoteName = git.DefaultRemoteName
+	opt.Auth = auth
+	opt.Tags = git.AllTags
+	opt.Force = true
+	if err = r.Raw.FetchContext(ctx, opt); err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	var cfg *config.Config
+	if cfg, err = r.Raw.Config(); err != nil || !cfg.Core.IsBare {
+		return
+	}
+	return r.followRemoteHead(ctx, auth)
+}
+
+func (r *Repo) followRemoteHead(ctx context.Context, auth transport.AuthMethod) error {
+	remote, err := r.Raw.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return err
+	}
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+			break
+		}
+	}
+	if head == nil {
+		return nil
+	}
+	target := head.Target()
+	if head.Type() != plumbing.SymbolicReference {
+		target = ""
+		for _, ref := range refs {
+			if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+				target = ref.Name()
+				break
+			}
+		}
+		if target == "" {
+			return nil
+		}
+	}
+	return r.Raw.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, target))
+}
 func (r *Repo) CurrentBranch() (*Branch, error) {
 	if r.currentBranch == nil {
 		if v, err := r.Raw.Head(); err != nil {
@@ -114,6 +213,8 @@ func (r *Repo) CurrentBranch() (*Branch, error) {
 	return r.currentBranch, nil
 }
 func (r *Repo) Branches() ([]*Branch, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
 	if r.br == nil {
 		x, err := r.Raw.References()
 		if err != nil {
@@ -137,6 +238,8 @@ func (r *Repo) Remotes() ([]*git.Remote, error) {
 	return r.Raw.Remotes()
 }
 func (r *Repo) Tags() ([]*Signature, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
 	t, er := r.Raw.Tags()
 	if er != nil {
 		return nil, er
@@ -178,22 +281,95 @@ func (r *Repo) Checkout(branch *Branch) (err error) {
 	return
 }
 
-//zip as standard zip @see ZipWith
-func (r *Repo) Zip() (path *os.File, err error) {
-	path, err = ioutil.TempFile("", "temp_zip_*")
-	w := zip.NewWriter(path)
-	defer func() {
-		err1 := w.Close()
-		if err1 != nil {
-			err = err1
+//resolve commit of a hash, annotated tag will be peeled to it's commit
+func (r *Repo) Commit(hash string) (*object.Commit, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	return r.commit(hash)
+}
+func (r *Repo) commit(hash string) (*object.Commit, error) {
+	h := plumbing.NewHash(hash)
+	if t, err := r.Raw.TagObject(h); err == nil {
+		return t.Commit()
+	}
+	return r.Raw.CommitObject(h)
+}
+
+//find a commit by full hash or a hash prefix, ErrAmbiguousCommit when more than one commit has the prefix
+func (r *Repo) FindCommit(prefix string) (c *object.Commit, err error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 4 || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	if len(prefix) == 40 {
+		return r.commit(prefix)
+	}
+	var iter object.CommitIter
+	if iter, err = r.Raw.CommitObjects(); err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(x *object.Commit) error {
+		if strings.HasPrefix(x.Hash.String(), prefix) {
+			if c != nil {
+				return ErrAmbiguousCommit
+			}
+			c = x
 		}
-		return
-	}()
-	err = AddFilesToZip(w, r.Path, "")
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return path, nil
+	if c == nil {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	return c, nil
+}
+
+//hashes of a commit and all it's ancestors
+func (r *Repo) Ancestors(hash string) (map[string]bool, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	iter, err := r.Raw.Log(&git.LogOptions{From: plumbing.NewHash(hash)})
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]bool)
+	err = iter.ForEach(func(c *object.Commit) error {
+		m[c.Hash.String()] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//checkout worktree to a commit or tag hash (detached)
+func (r *Repo) CheckoutHash(hash string) (err error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	var c *object.Commit
+	if c, err = r.commit(hash); err != nil {
+		return
+	}
+	var w *git.Worktree
+	if w, err = r.Raw.Worktree(); err != nil {
+		return
+	}
+	opt := new(git.CheckoutOptions)
+	opt.Hash = c.Hash
+	opt.Force = true
+	r.currentBranch = nil
+	err = w.Checkout(opt)
+	return
+}
+
+//zip the module under subPath of current worktree as a module zip @see CreateModuleZip. the returned file is rewound to start.
+func (r *Repo) Zip(mod mpc.Module, version mpc.Version, subPath string) (*os.File, error) {
+	return CreateModuleZipFile(mod, version, path.Join(r.Path, subPath))
 }
 
 //create a self defined zip structure @see AddFilesToZip as example
@@ -223,7 +399,118 @@ func (r *Repo) Mod(subPath string) (string, error) {
 	return string(b), nil
 }
 
-//a standard Add Files to zip
+//the tree of a revision (commit or tag hash) under subPath
+func (r *Repo) TreeAt(hash string, subPath string) (*object.Tree, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	return r.treeAt(hash, subPath)
+}
+func (r *Repo) treeAt(hash string, subPath string) (*object.Tree, error) {
+	c, err := r.commit(hash)
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if subPath == "" || subPath == "." {
+		return t, nil
+	}
+	return t.Tree(subPath)
+}
+
+//read a file at a revision (commit or tag hash) from object storage, the worktree is untouched
+func (r *Repo) FileAt(hash string, file string) ([]byte, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	t, err := r.treeAt(hash, "")
+	if err != nil {
+		return nil, err
+	}
+	f, err := t.File(file)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return ioutil.ReadAll(rd)
+}
+
+//read go.mod under subPath at a revision (commit or tag hash) from object storage
+func (r *Repo) ModAt(hash string, subPath string) (string, error) {
+	b, err := r.FileAt(hash, path.Join(subPath, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//list files under subPath at a revision (commit or tag hash), paths are relative to subPath.
+//the files must not be opened concurrently with other reading of the Repo, use ZipAt to build a zip from them.
+func (r *Repo) FilesAt(hash string, subPath string) ([]modzip.File, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	return r.filesAt(hash, subPath)
+}
+func (r *Repo) filesAt(hash string, subPath string) ([]modzip.File, error) {
+	t, err := r.treeAt(hash, subPath)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]modzip.File, 0, len(t.Entries))
+	err = t.Files().ForEach(func(f *object.File) error {
+		files = append(files, treeFile{f})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+//zip the module under subPath at a revision (commit or tag hash) as a module zip @see CreateModuleZip.
+//as go command does, the LICENSE of repository root is included when the sub directory module has none.
+//the returned file is rewound to start.
+func (r *Repo) ZipAt(mod mpc.Module, version mpc.Version, hash string, subPath string) (*os.File, error) {
+	r.objects.Lock()
+	defer r.objects.Unlock()
+	files, err := r.filesAt(hash, subPath)
+	if err != nil {
+		return nil, err
+	}
+	if subPath != "" && subPath != "." {
+		files, err = r.withRootLicense(hash, files)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return CreateModuleZipFileOf(mod, version, files)
+}
+
+func (r *Repo) withRootLicense(hash string, files []modzip.File) ([]modzip.File, error) {
+	for _, f := range files {
+		if f.Path() == "LICENSE" {
+			return files, nil
+		}
+	}
+	t, err := r.treeAt(hash, "")
+	if err != nil {
+		return nil, err
+	}
+	f, err := t.File("LICENSE")
+	if err == object.ErrFileNotFound {
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append(files, treeFile{f}), nil
+}
+
+//a standard Add Files to zip, entries are relative to baseInZip. use CreateModuleZip for a module zip.
 func AddFilesToZip(w *zip.Writer, basePath, baseInZip string) error {
 	files, err := ioutil.ReadDir(basePath)
 	if err != nil {
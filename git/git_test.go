@@ -20,6 +20,10 @@ package git
 
 import (
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
 	"testing"
 )
 import "github.com/stretchr/testify/assert"
@@ -43,3 +47,68 @@ func TestGitSSHClone(t *testing.T) {
 	_, err = g.Clone(SSH, "", auth)
 	assert.Nil(t, err)
 }
+
+func TestRepo_ReadAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := newTestRepo(t, dir, "some",
+		testRevision{
+			files: map[string]string{"go.mod": "module git.x/some\n", "a.go": "package some\n"},
+			tag:   "v1.0.0",
+			when:  testTime,
+		},
+		testRevision{
+			files: map[string]string{"go.mod": "module git.x/some\n\ngo 1.16\n", "sub/b.go": "package sub\n"},
+			tag:   "v1.1.0",
+			when:  testTime,
+		},
+	)
+	r, err := new(Git).Open(bare)
+	if !assert.Nil(t, err) {
+		return
+	}
+	tags, err := versionTags(r, "")
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m, err := r.ModAt(tags["v1.0.0"], "")
+			assert.Nil(t, err)
+			assert.Equal(t, "module git.x/some\n", m)
+		}()
+		go func() {
+			defer wg.Done()
+			m, err := r.ModAt(tags["v1.1.0"], "")
+			assert.Nil(t, err)
+			assert.Equal(t, "module git.x/some\n\ngo 1.16\n", m)
+		}()
+	}
+	wg.Wait()
+
+	files, err := r.FilesAt(tags["v1.1.0"], "")
+	assert.Nil(t, err)
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Path())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"a.go", "go.mod", "sub/b.go"}, names)
+
+	files, err = r.FilesAt(tags["v1.1.0"], "sub")
+	assert.Nil(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "b.go", files[0].Path())
+	}
+	_, err = r.FilesAt(tags["v1.0.0"], "sub")
+	assert.NotNil(t, err)
+
+	f, err := r.ZipAt("git.x/some", "v1.0.0", tags["v1.0.0"], "")
+	if assert.Nil(t, err) {
+		_ = tempFile{newZipFile(f)}.Close()
+	}
+}
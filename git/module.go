@@ -0,0 +1,149 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"github.com/ZenLiuCN/mpc"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"path"
+	"strings"
+)
+
+const incompatible = "+incompatible"
+
+//location of a module inside a repository, follows the rules of go command for VCS modules
+type location struct {
+	//module path
+	module mpc.Module
+	//directory of module inside repository without major suffix, also is the tag prefix.
+	//eg: for module git.x/some/sub/dir/v2 in repository git.x/some, dir is sub/dir and tags are sub/dir/v2.x.x
+	dir string
+	//major version suffix of module path, like /v2. empty for v0 and v1
+	major string
+}
+
+//locate a module inside the repository with root module path
+func locate(mod mpc.Module, root string) (loc location, ok bool) {
+	prefix, major, ok := module.SplitPathVersion(string(mod))
+	if !ok {
+		return
+	}
+	switch {
+	case prefix == root:
+	case strings.HasPrefix(prefix, root+"/"):
+		loc.dir = strings.TrimPrefix(prefix, root+"/")
+	default:
+		return location{}, false
+	}
+	loc.module = mod
+	loc.major = major
+	return loc, true
+}
+
+//tag prefix of module
+func (l location) tagPrefix() string {
+	if l.dir == "" {
+		return ""
+	}
+	return l.dir + "/"
+}
+
+//semver tags of a repository with prefix, mapping version to commit hash
+func versionTags(repo *Repo, prefix string) (map[mpc.Version]string, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	v := make(map[mpc.Version]string, len(tags))
+	for _, tag := range tags {
+		name := plumbing.ReferenceName(tag.Name).Short()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if !semver.IsValid(name) || semver.Canonical(name) != name || mpc.IsPseudoVersion(mpc.Version(name)) {
+			continue
+		}
+		c, err := repo.Commit(tag.Hash)
+		if err != nil {
+			continue
+		}
+		v[mpc.Version(name)] = c.Hash.String()
+	}
+	return v, nil
+}
+
+//versions of module, mapping version to commit hash.
+//for a module without major suffix, v2+ tags without go.mod are presented as +incompatible versions.
+//for a module with major suffix, only tags of that major are valid.
+func moduleTags(repo *Repo, loc location) (map[mpc.Version]string, error) {
+	tags, err := versionTags(repo, loc.tagPrefix())
+	if err != nil {
+		return nil, err
+	}
+	v := make(map[mpc.Version]string, len(tags))
+	for version, hash := range tags {
+		major := semver.Major(string(version))
+		switch {
+		case loc.major != "":
+			if major == loc.major[1:] {
+				v[version] = hash
+			}
+		case major == "v0" || major == "v1":
+			v[version] = hash
+		default:
+			if _, err := repo.ModAt(hash, loc.dir); err != nil {
+				v[version+incompatible] = hash
+			}
+		}
+	}
+	return v, nil
+}
+
+//directory and go.mod of module at a commit.
+//a module with major suffix /vN may live in the major sub directory dir/vN, or in dir with go.mod declares the full path.
+//a module without go.mod has a synthesized go.mod.
+func moduleDir(repo *Repo, loc location, version mpc.Version, hash string) (dir string, mod string, err error) {
+	if loc.major != "" {
+		dir = path.Join(loc.dir, loc.major[1:])
+		if mod, err = repo.ModAt(hash, dir); err == nil && modfile.ModulePath([]byte(mod)) == string(loc.module) {
+			return
+		}
+	}
+	dir = loc.dir
+	if mod, err = repo.ModAt(hash, dir); err == nil {
+		if modfile.ModulePath([]byte(mod)) != string(loc.module) {
+			return "", "", ErrUnknownVersion
+		}
+		if strings.HasSuffix(string(version), incompatible) {
+			return "", "", ErrUnknownVersion
+		}
+		return
+	}
+	if loc.major != "" {
+		return "", "", ErrUnknownVersion
+	}
+	if _, err = repo.TreeAt(hash, dir); err != nil {
+		return "", "", ErrUnknownVersion
+	}
+	return dir, "module " + modfile.AutoQuote(string(loc.module)) + "\n", nil
+}
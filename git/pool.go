@@ -0,0 +1,215 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//DefaultPool used by Resolver without a Pool
+var DefaultPool = NewPool(filepath.Join(os.TempDir(), "mpc_git"), time.Minute)
+
+// Pool is a persistent on-disk pool of repositories.
+// repositories are bare mirrors under Root keyed by clone uri and auth, they are reused across restarts and
+// fetched at most once per MinRefresh (failed fetches too). concurrent requests of a repository never clone or fetch twice.
+// a uri used with different auth methods has a mirror for each of them, so no one is fetched with the auth of another.
+type Pool struct {
+	//root directory of mirrors
+	Root string
+	//minimum interval between two fetches of a repository
+	MinRefresh time.Duration
+	git        *Git
+	lock       sync.Mutex
+	repos      map[string]*poolEntry
+}
+
+type poolEntry struct {
+	//guard clone and fetch
+	lock sync.Mutex
+	uri  string
+	auth transport.AuthMethod
+	repo *Repo
+	//time of last fetch, successful or not
+	fetched time.Time
+}
+
+func NewPool(root string, minRefresh time.Duration) *Pool {
+	return &Pool{Root: root, MinRefresh: minRefresh, repos: make(map[string]*poolEntry)}
+}
+
+//key of a mirror: the uri, with a hash of the credential of auth if any
+func poolKey(uri string, auth transport.AuthMethod) string {
+	if auth == nil {
+		return uri
+	}
+	h := sha256.Sum256([]byte(credential(auth)))
+	return uri + "\n" + auth.Name() + "\n" + hex.EncodeToString(h[:])
+}
+
+//the secret of known auth methods, String of them masks the secret.
+//others are identified by the auth itself.
+func credential(auth transport.AuthMethod) string {
+	switch a := auth.(type) {
+	case *http.BasicAuth:
+		return a.Username + "\n" + a.Password
+	case *http.TokenAuth:
+		return a.Token
+	case *ssh.Password:
+		return a.User + "\n" + a.Password
+	case *ssh.PublicKeys:
+		if a.Signer == nil {
+			return a.User
+		}
+		return a.User + "\n" + string(a.Signer.PublicKey().Marshal())
+	default:
+		return fmt.Sprintf("%T@%p", auth, auth)
+	}
+}
+
+//directory of a mirror
+func (p *Pool) dir(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(p.Root, hex.EncodeToString(h[:16])+".git")
+}
+
+func (p *Pool) entry(uri string, auth transport.AuthMethod) *poolEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.repos == nil {
+		p.repos = make(map[string]*poolEntry)
+	}
+	key := poolKey(uri, auth)
+	e, ok := p.repos[key]
+	if !ok {
+		e = &poolEntry{uri: uri, auth: auth}
+		p.repos[key] = e
+	}
+	return e
+}
+
+// Get the repository of uri: open an existing mirror or clone a new one, then fetch when last fetch is older than MinRefresh.
+// a failed fetch of an existing mirror is ignored and the stale mirror is returned, it's not retried before MinRefresh.
+func (p *Pool) Get(uri string, auth transport.AuthMethod) (*Repo, error) {
+	return p.GetContext(context.Background(), uri, auth)
+}
+
+// GetContext as Get, the clone or fetch is canceled by ctx.
+func (p *Pool) GetContext(ctx context.Context, uri string, auth transport.AuthMethod) (*Repo, error) {
+	e := p.entry(uri, auth)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.repo == nil {
+		if err := p.open(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+	if time.Since(e.fetched) >= p.MinRefresh {
+		if err := e.repo.FetchContext(ctx, e.auth); err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		e.fetched = time.Now()
+	}
+	return e.repo, nil
+}
+
+func (p *Pool) open(ctx context.Context, e *poolEntry) (err error) {
+	dir := p.dir(poolKey(e.uri, e.auth))
+	if _, err = os.Stat(dir); err == nil {
+		e.repo, err = p.git.Open(dir)
+		return
+	}
+	if err = os.MkdirAll(p.Root, 0755); err != nil {
+		return
+	}
+	if e.repo, err = p.git.MirrorContext(ctx, e.uri, dir, e.auth); err != nil {
+		_ = os.RemoveAll(dir)
+		return
+	}
+	e.fetched = time.Now()
+	return
+}
+
+// Refresh fetch mirrors of a repository of the pool immediately, ignore MinRefresh.
+func (p *Pool) Refresh(uri string) (err error) {
+	for _, e := range p.entries() {
+		if e.uri != uri {
+			continue
+		}
+		if e := p.refresh(e); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (p *Pool) entries() []*poolEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	entries := make([]*poolEntry, 0, len(p.repos))
+	for _, e := range p.repos {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (p *Pool) refresh(e *poolEntry) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.repo == nil {
+		return nil
+	}
+	if err := e.repo.Fetch(e.auth); err != nil {
+		return err
+	}
+	e.fetched = time.Now()
+	return nil
+}
+
+// Start fetch all repositories of the pool in background every interval, call the returned stop to end it.
+func (p *Pool) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				for _, e := range p.entries() {
+					_ = p.refresh(e)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
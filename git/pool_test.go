@@ -0,0 +1,176 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool_Get(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := newTestRepo(t, dir, "some", testRevision{
+		files: map[string]string{"go.mod": "module git.x/some\n"},
+		tag:   "v1.0.0",
+		when:  testTime,
+	})
+	uri := "file://" + bare
+	root := filepath.Join(dir, "pool")
+	p := NewPool(root, time.Hour)
+
+	//concurrent gets share one mirror
+	repos := make([]*Repo, 8)
+	var wg sync.WaitGroup
+	for i := range repos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := p.Get(uri, nil)
+			assert.Nil(t, err)
+			repos[i] = r
+		}(i)
+	}
+	wg.Wait()
+	for _, r := range repos {
+		assert.True(t, r == repos[0])
+	}
+	mirrors, err := ioutil.ReadDir(root)
+	assert.Nil(t, err)
+	assert.Len(t, mirrors, 1)
+	head, err := repos[0].Raw.Head()
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "refs/heads/master", head.Name().String())
+
+	//new tag is invisible before MinRefresh
+	src, err := git.PlainOpen(bare)
+	if !assert.Nil(t, err) {
+		return
+	}
+	srcHead, err := src.Head()
+	assert.Nil(t, err)
+	_, err = src.CreateTag("v1.0.1", srcHead.Hash(), nil)
+	assert.Nil(t, err)
+	r, err := p.Get(uri, nil)
+	assert.Nil(t, err)
+	tags, err := versionTags(r, "")
+	assert.Nil(t, err)
+	assert.Len(t, tags, 1)
+
+	//refresh immediately
+	assert.Nil(t, p.Refresh(uri))
+	tags, err = versionTags(r, "")
+	assert.Nil(t, err)
+	assert.Len(t, tags, 2)
+
+	//a new pool reuses the existing mirror
+	p2 := NewPool(root, time.Hour)
+	r2, err := p2.Get(uri, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, r.Path, r2.Path)
+	tags, err = versionTags(r2, "")
+	assert.Nil(t, err)
+	assert.Len(t, tags, 2)
+
+	//unknown repository
+	_, err = p.Get("file://"+filepath.Join(dir, "none.git"), nil)
+	assert.NotNil(t, err)
+	mirrors, err = ioutil.ReadDir(root)
+	assert.Nil(t, err)
+	assert.Len(t, mirrors, 1)
+
+	//a uri with auth has it's own mirror
+	auth := &http.BasicAuth{Username: "some", Password: "secret"}
+	r3, err := p.Get(uri, auth)
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, r.Path, r3.Path)
+		assert.True(t, p.repos[poolKey(uri, auth)].auth == auth)
+		assert.Nil(t, p.repos[uri].auth)
+	}
+
+	//credentials differ only in secret have their own mirrors
+	other := &http.BasicAuth{Username: "some", Password: "other"}
+	r4, err := p.Get(uri, other)
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, r3.Path, r4.Path)
+		assert.True(t, p.repos[poolKey(uri, other)].auth == other)
+		assert.True(t, p.repos[poolKey(uri, auth)].auth == auth)
+	}
+	assert.Equal(t, poolKey(uri, auth), poolKey(uri, &http.BasicAuth{Username: "some", Password: "secret"}))
+	assert.NotEqual(t, poolKey(uri, &http.TokenAuth{Token: "a"}), poolKey(uri, &http.TokenAuth{Token: "b"}))
+
+	//a failed fetch is not retried before MinRefresh
+	p.repos[uri].fetched = time.Time{}
+	assert.Nil(t, os.RemoveAll(bare))
+	start := time.Now()
+	r, err = p.Get(uri, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, r2.Path, r.Path)
+	assert.False(t, p.repos[uri].fetched.Before(start))
+}
+
+func TestPool_Start(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := newTestRepo(t, dir, "some", testRevision{
+		files: map[string]string{"go.mod": "module git.x/some\n"},
+		tag:   "v1.0.0",
+		when:  testTime,
+	})
+	uri := "file://" + bare
+	p := NewPool(filepath.Join(dir, "pool"), time.Hour)
+	r, err := p.Get(uri, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	src, err := git.PlainOpen(bare)
+	if !assert.Nil(t, err) {
+		return
+	}
+	srcHead, err := src.Head()
+	assert.Nil(t, err)
+	_, err = src.CreateTag("v1.0.1", srcHead.Hash(), nil)
+	assert.Nil(t, err)
+
+	stop := p.Start(10 * time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if tags, err := versionTags(r, ""); err == nil && len(tags) == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("background refresh not fetched new tag")
+}
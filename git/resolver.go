@@ -19,12 +19,25 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"github.com/ZenLiuCN/mpc"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"io/ioutil"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"io"
 	"os"
 	"strings"
+	"time"
+)
+
+var (
+	//all are mpc.ErrNotFound
+	ErrUnknownModule     = fmt.Errorf("%w: module not mapped to any repository", mpc.ErrNotFound)
+	ErrUnknownRepository = fmt.Errorf("%w: repository not found", mpc.ErrNotFound)
+	ErrUnknownVersion    = fmt.Errorf("%w: version not found in repository", mpc.ErrNotFound)
 )
 
 type Resolver struct {
@@ -36,6 +49,12 @@ type Resolver struct {
 	Mapping map[string]string
 	//for cache resolved data
 	cache Cache
+	//repositories pool, DefaultPool when nil
+	Pool *Pool
+}
+
+func NewResolver(auth transport.AuthMethod, mapping map[string]string, cache Cache) *Resolver {
+	return &Resolver{Auth: auth, Mapping: mapping, cache: cache}
 }
 
 /**
@@ -64,33 +83,321 @@ func (s *Resolver) resolve(module mpc.Module) (uri string, name string, path str
 	}
 	return
 }
-func (s *Resolver) cloneOrOpen(uri string, name string) (repo *Repo, err error) {
-	dir, err := ioutil.TempDir("", "repo_"+name)
-	if os.IsExist(err) {
-		repo, err = s.git.Open(dir)
-		if err != nil {
+//open or clone the mirror of repository from Pool
+func (s *Resolver) cloneOrOpen(ctx context.Context, uri string) (repo *Repo, err error) {
+	p := s.Pool
+	if p == nil {
+		p = DefaultPool
+	}
+	return p.GetContext(ctx, uri, s.Auth)
+}
+
+//open the repository of a module, returns the location of module inside repository
+func (s *Resolver) open(ctx context.Context, mod mpc.Module) (repo *Repo, loc location, err error) {
+	uri, _, sub := s.resolve(mod)
+	if uri == "" {
+		return nil, location{}, ErrUnknownModule
+	}
+	root := strings.TrimSuffix(strings.TrimSuffix(string(mod), sub), "/")
+	var ok bool
+	if loc, ok = locate(mod, root); !ok {
+		return nil, location{}, ErrUnknownModule
+	}
+	if repo, err = s.cloneOrOpen(ctx, uri); err == transport.ErrRepositoryNotFound {
+		err = ErrUnknownRepository
+	}
+	return
+}
+
+//sorted versions of tags
+func sortedVersions(tags map[mpc.Version]string) mpc.Versions {
+	v := make(mpc.Versions, 0, len(tags))
+	for version := range tags {
+		v = append(v, version)
+	}
+	v.Sort()
+	return v
+}
+
+//the latest version of tags, release versions are preferred than pre-release.
+//as go command does, +incompatible versions are excluded when the latest compatible release has a go.mod.
+func latestVersion(repo *Repo, loc location, tags map[mpc.Version]string) mpc.Version {
+	versions := sortedVersions(tags)
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := string(versions[i])
+		if semver.Prerelease(v) != "" || semver.Build(v) == incompatible {
+			continue
+		}
+		if _, err := repo.ModAt(tags[versions[i]], loc.dir); err == nil {
+			return versions[i]
+		}
+		break
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if semver.Prerelease(string(versions[i])) == "" {
+			return versions[i]
+		}
+	}
+	if len(versions) > 0 {
+		return versions[len(versions)-1]
+	}
+	return mpc.UndefinedVersion
+}
+
+//a resolved version of module
+type resolved struct {
+	repo    *Repo
+	version mpc.Version
+	commit  *object.Commit
+	//directory of module inside repository
+	dir string
+	mod string
+}
+
+//open repository and resolve the commit, directory and go.mod of version @see revision
+func (s *Resolver) openVersion(ctx context.Context, mod mpc.Module, version mpc.Version) (r resolved, err error) {
+	var loc location
+	if r.repo, loc, err = s.open(ctx, mod); err != nil {
+		return
+	}
+	if r.version, r.commit, err = revision(r.repo, loc, version); err != nil {
+		return
+	}
+	r.dir, r.mod, err = moduleDir(r.repo, loc, r.version, r.commit.Hash.String())
+	return
+}
+
+//resolve a version to it's canonical version and commit.
+//version may be LatestVersion, a semver tag, a pseudo-version, a branch name or a commit hash (prefix).
+//a branch or commit is presented as the semver tag on that commit, or a pseudo-version based on the highest ancestor tag.
+func revision(repo *Repo, loc location, version mpc.Version) (v mpc.Version, c *object.Commit, err error) {
+	var tags map[mpc.Version]string
+	if tags, err = moduleTags(repo, loc); err != nil {
+		return
+	}
+	var hash string
+	switch {
+	case version == mpc.LatestVersion:
+		if v = latestVersion(repo, loc, tags); v != mpc.UndefinedVersion {
+			c, err = repo.Commit(tags[v])
+			return
+		}
+		var head *plumbing.Reference
+		if head, err = repo.Raw.Head(); err != nil {
 			return
 		}
-		err = repo.Pull(s.Auth)
+		hash = head.Hash().String()
+	case tags[version] != "":
+		v = version
+		c, err = repo.Commit(tags[version])
 		return
-	} else if err != nil {
+	case mpc.IsPseudoVersion(version):
+		var rev string
+		var t time.Time
+		if rev, err = mpc.PseudoVersionRev(version); err != nil {
+			return
+		}
+		if t, err = mpc.PseudoVersionTime(version); err != nil {
+			return
+		}
+		if module.CheckPathMajor(string(version), loc.major) != nil {
+			err = ErrUnknownVersion
+			return
+		}
+		if c, err = repo.FindCommit(rev); err != nil {
+			err = ErrUnknownVersion
+			return
+		}
+		if !c.Committer.When.UTC().Truncate(time.Second).Equal(t) {
+			c, err = nil, ErrUnknownVersion
+			return
+		}
+		v = version
+		return
+	default:
+		if hash, err = branchOrCommit(repo, string(version)); err != nil {
+			return
+		}
+	}
+	if c, err = repo.Commit(hash); err != nil {
 		return
 	}
-	repo, err = s.git.Clone(uri, dir, s.Auth) //todo may resolved not a repo
+	v, err = pseudoVersion(repo, loc, tags, c)
 	return
 }
+
+//the hash of a branch, or a commit hash (prefix)
+func branchOrCommit(repo *Repo, rev string) (string, error) {
+	branches, err := repo.Branches()
+	if err != nil {
+		return "", err
+	}
+	for _, b := range branches {
+		if b.Name == rev || (b.Remote && b.ShortName() == rev) {
+			return b.Hash, nil
+		}
+	}
+	c, err := repo.FindCommit(rev)
+	if err != nil {
+		return "", ErrUnknownVersion
+	}
+	return c.Hash.String(), nil
+}
+
+//version of commit: the highest tag on commit itself, or a pseudo-version based on the highest ancestor tag
+func pseudoVersion(repo *Repo, loc location, tags map[mpc.Version]string, c *object.Commit) (mpc.Version, error) {
+	hash := c.Hash.String()
+	versions := sortedVersions(tags)
+	for i := len(versions) - 1; i >= 0; i-- {
+		if tags[versions[i]] == hash {
+			return versions[i], nil
+		}
+	}
+	ancestors, err := repo.Ancestors(hash)
+	if err != nil {
+		return mpc.UndefinedVersion, err
+	}
+	base := mpc.UndefinedVersion
+	for i := len(versions) - 1; i >= 0; i-- {
+		if ancestors[tags[versions[i]]] {
+			base = versions[i]
+			break
+		}
+	}
+	return mpc.PseudoVersion(strings.TrimPrefix(loc.major, "/"), base, c.Committer.When, hash)
+}
+
+// Context the ResolverV2 of Resolver, clone and fetch of repositories are canceled by context.
+func (s *Resolver) Context() mpc.ResolverV2 {
+	return contextResolver{s}
+}
+
 func (s *Resolver) Versions(module mpc.Module) mpc.Versions {
-	panic("implement me")
+	v, _ := s.Context().Versions(context.Background(), module)
+	return v
 }
 
 func (s *Resolver) Info(module mpc.Module, version mpc.Version) *mpc.Info {
-	panic("implement me")
+	i, _ := s.Context().Info(context.Background(), module, version)
+	return i
 }
 
 func (s *Resolver) Mod(module mpc.Module, version mpc.Version) mpc.GoMod {
-	panic("implement me")
+	m, _ := s.Context().Mod(context.Background(), module, version)
+	return m
 }
 
 func (s *Resolver) Zip(module mpc.Module, version mpc.Version) mpc.GoZip {
-	panic("implement me")
+	z, err := s.Context().Zip(context.Background(), module, version)
+	if err != nil {
+		return nil
+	}
+	return z
+}
+
+//region contextResolver
+
+type contextResolver struct {
+	*Resolver
+}
+
+//versions from repository, cached versions are only used when repository is unavailable
+func (s contextResolver) Versions(ctx context.Context, module mpc.Module) (mpc.Versions, error) {
+	repo, loc, err := s.open(ctx, module)
+	if err == ErrUnknownModule {
+		return nil, err
+	} else if err != nil {
+		if s.cache != nil && ctx.Err() == nil {
+			if v := s.cache.Versions(module); len(v) > 0 {
+				return v, nil
+			}
+		}
+		return nil, err
+	}
+	tags, err := moduleTags(repo, loc)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	v := sortedVersions(tags)
+	if s.cache != nil {
+		s.cache.SetVersions(module, v)
+	}
+	return v, nil
+}
+
+func (s contextResolver) Info(ctx context.Context, module mpc.Module, version mpc.Version) (*mpc.Info, error) {
+	if s.cache != nil && mpc.IsCanonicalVersion(version) {
+		if i := s.cache.Info(module, version); i != nil {
+			return i, nil
+		}
+	}
+	r, err := s.openVersion(ctx, module, version)
+	if err != nil {
+		return nil, err
+	}
+	i := &mpc.Info{
+		Version: r.version,
+		Time:    r.commit.Committer.When.UTC(),
+	}
+	if s.cache != nil {
+		s.cache.SetInfo(module, r.version, i)
+	}
+	return i, nil
+}
+
+func (s contextResolver) Mod(ctx context.Context, module mpc.Module, version mpc.Version) (mpc.GoMod, error) {
+	if s.cache != nil && mpc.IsCanonicalVersion(version) {
+		if m := s.cache.Mod(module, version); m != "" {
+			return m, nil
+		}
+	}
+	r, err := s.openVersion(ctx, module, version)
+	if err != nil {
+		return "", err
+	}
+	if s.cache != nil {
+		s.cache.SetMod(module, r.version, mpc.GoMod(r.mod))
+	}
+	return mpc.GoMod(r.mod), nil
+}
+
+func (s contextResolver) Zip(ctx context.Context, module mpc.Module, version mpc.Version) (mpc.GoZip, error) {
+	if s.cache != nil && mpc.IsCanonicalVersion(version) {
+		if z := s.cache.Zip(module, version); z != nil {
+			return z, nil
+		}
+	}
+	r, err := s.openVersion(ctx, module, version)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.repo.ZipAt(module, r.version, r.commit.Hash.String(), r.dir)
+	if err != nil {
+		return nil, err
+	}
+	z := newZipFile(f)
+	if s.cache != nil {
+		s.cache.SetZip(module, r.version, unclosedZip{z})
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			_ = tempFile{z}.Close()
+			return nil, err
+		}
+	}
+	return tempFile{z}, nil
+}
+
+//endregion
+
+//a temporary zip file removed on close
+type tempFile struct {
+	zipFile
+}
+
+func (t tempFile) Close() error {
+	err := t.File.Close()
+	_ = os.Remove(t.Name())
+	return err
 }
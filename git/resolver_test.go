@@ -19,9 +19,21 @@
 package git
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"github.com/ZenLiuCN/mpc"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestResolver_resolve(t *testing.T) {
@@ -98,3 +110,325 @@ func TestResolver_resolve(t *testing.T) {
 		})
 	}
 }
+
+//a revision of test repository
+type testRevision struct {
+	files map[string]string //nil content remove the file
+	tag   string
+	//create annotated tag
+	annotated bool
+	when      time.Time
+}
+
+//create a bare repository $dir/$name.git with revisions
+func newTestRepo(t *testing.T, dir, name string, revisions ...testRevision) string {
+	work := filepath.Join(dir, name+"_work")
+	repo, err := git.PlainInit(work, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range revisions {
+		for file, content := range rev.files {
+			p := filepath.Join(work, file)
+			if content == "" {
+				_, _ = w.Remove(file)
+				continue
+			}
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err = ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = w.Add(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sig := &object.Signature{Name: "tester", Email: "tester@mpc", When: rev.when}
+		h, err := w.Commit("commit "+rev.tag, &git.CommitOptions{Author: sig, Committer: sig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev.tag == "" {
+			continue
+		}
+		var opt *git.CreateTagOptions
+		if rev.annotated {
+			opt = &git.CreateTagOptions{Tagger: sig, Message: rev.tag}
+		}
+		if _, err = repo.CreateTag(rev.tag, h, opt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bare := filepath.Join(dir, name+".git")
+	if _, err = git.PlainClone(bare, true, &git.CloneOptions{URL: work}); err != nil {
+		t.Fatal(err)
+	}
+	return bare
+}
+
+var testTime = time.Date(2021, 10, 10, 10, 10, 10, 0, time.UTC)
+
+func newTestResolver(t *testing.T) *Resolver {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	newTestRepo(t, dir, "some",
+		testRevision{
+			files: map[string]string{"go.mod": "module git.x/some\n\ngo 1.14\n", "a.go": "package some\n"},
+			tag:   "v1.0.0",
+			when:  testTime,
+		},
+		testRevision{
+			files: map[string]string{"go.mod": "module git.x/some\n\ngo 1.16\n", "b.go": "package some\n"},
+			tag:   "v1.1.0",
+			when:  testTime.Add(time.Hour),
+		},
+		testRevision{
+			files:     map[string]string{"c.go": "package some\n"},
+			tag:       "v1.2.0-rc.1",
+			annotated: true,
+			when:      testTime.Add(2 * time.Hour),
+		},
+		testRevision{
+			files: map[string]string{"d.go": "package some\n"},
+			tag:   "not-a-version",
+			when:  testTime.Add(3 * time.Hour),
+		},
+	)
+	return &Resolver{Mapping: map[string]string{"git.x/": "file://" + dir + "/"}, Pool: NewPool(filepath.Join(dir, "pool"), time.Minute)}
+}
+
+func TestResolver_Versions(t *testing.T) {
+	s := newTestResolver(t)
+	assert.Equal(t, mpc.ParseVersions("v1.0.0\nv1.1.0\nv1.2.0-rc.1"), s.Versions("git.x/some"))
+	assert.Equal(t, mpc.Versions(nil), s.Versions("git.x/none"))
+	assert.Equal(t, mpc.Versions(nil), s.Versions("other.x/some"))
+}
+
+func TestResolver_Info(t *testing.T) {
+	s := newTestResolver(t)
+	assert.Equal(t, &mpc.Info{Version: "v1.0.0", Time: testTime}, s.Info("git.x/some", "v1.0.0"))
+	assert.Equal(t, &mpc.Info{Version: "v1.1.0", Time: testTime.Add(time.Hour)}, s.Info("git.x/some", mpc.LatestVersion))
+	assert.Equal(t, &mpc.Info{Version: "v1.2.0-rc.1", Time: testTime.Add(2 * time.Hour)}, s.Info("git.x/some", "v1.2.0-rc.1"))
+	assert.Nil(t, s.Info("git.x/some", "v1.3.0"))
+}
+
+func TestResolver_Mod(t *testing.T) {
+	s := newTestResolver(t)
+	assert.Equal(t, mpc.GoMod("module git.x/some\n\ngo 1.14\n"), s.Mod("git.x/some", "v1.0.0"))
+	assert.Equal(t, mpc.GoMod("module git.x/some\n\ngo 1.16\n"), s.Mod("git.x/some", "v1.1.0"))
+	assert.Equal(t, mpc.GoMod(""), s.Mod("git.x/some", "v1.3.0"))
+}
+
+func TestResolver_Zip(t *testing.T) {
+	s := newTestResolver(t)
+	z := s.Zip("git.x/some", "v1.1.0")
+	if !assert.NotNil(t, z) {
+		return
+	}
+	b, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	assert.Nil(t, z.Close())
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	names := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"git.x/some@v1.1.0/a.go", "git.x/some@v1.1.0/b.go", "git.x/some@v1.1.0/go.mod"}, names)
+	assert.Nil(t, s.Zip("git.x/some", "v1.3.0"))
+}
+
+func TestResolver_PseudoVersion(t *testing.T) {
+	s := newTestResolver(t)
+	dir := strings.TrimPrefix(s.Mapping["git.x/"], "file://")
+	repo, err := new(Git).Open(filepath.Join(dir, "some.git"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	head, err := repo.Raw.Head()
+	if !assert.Nil(t, err) {
+		return
+	}
+	hash := head.Hash().String()
+	pseudo := mpc.Version("v1.2.0-rc.1.0.20211010131010-" + hash[:12])
+
+	assert.Equal(t, &mpc.Info{Version: pseudo, Time: testTime.Add(3 * time.Hour)}, s.Info("git.x/some", "master"))
+	assert.Equal(t, &mpc.Info{Version: pseudo, Time: testTime.Add(3 * time.Hour)}, s.Info("git.x/some", mpc.Version(hash[:8])))
+	assert.Equal(t, &mpc.Info{Version: pseudo, Time: testTime.Add(3 * time.Hour)}, s.Info("git.x/some", pseudo))
+	assert.Nil(t, s.Info("git.x/some", mpc.Version("v1.2.0-rc.1.0.20211010131011-"+hash[:12])))
+	assert.Nil(t, s.Info("git.x/some", "no-such-branch"))
+	assert.Equal(t, mpc.GoMod("module git.x/some\n\ngo 1.16\n"), s.Mod("git.x/some", pseudo))
+	z := s.Zip("git.x/some", pseudo)
+	if assert.NotNil(t, z) {
+		assert.Nil(t, z.Close())
+	}
+
+	//a commit with a tag is presented as the tag
+	tags, err := versionTags(repo, "")
+	assert.Nil(t, err)
+	assert.Equal(t, &mpc.Info{Version: "v1.1.0", Time: testTime.Add(time.Hour)}, s.Info("git.x/some", mpc.Version(tags["v1.1.0"][:12])))
+}
+
+func TestResolver_PseudoVersionWithoutTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := newTestRepo(t, dir, "notag", testRevision{
+		files: map[string]string{"go.mod": "module git.x/notag\n"},
+		when:  testTime,
+	})
+	s := &Resolver{Mapping: map[string]string{"git.x/": "file://" + dir + "/"}, Pool: NewPool(filepath.Join(dir, "pool"), time.Minute)}
+	repo, err := new(Git).Open(bare)
+	if !assert.Nil(t, err) {
+		return
+	}
+	head, err := repo.Raw.Head()
+	if !assert.Nil(t, err) {
+		return
+	}
+	pseudo := mpc.Version("v0.0.0-20211010101010-" + head.Hash().String()[:12])
+	assert.Equal(t, mpc.Versions(nil), s.Versions("git.x/notag"))
+	assert.Equal(t, &mpc.Info{Version: pseudo, Time: testTime}, s.Info("git.x/notag", mpc.LatestVersion))
+	assert.Equal(t, mpc.GoMod("module git.x/notag\n"), s.Mod("git.x/notag", pseudo))
+}
+
+//names of zip entries
+func zipNames(t *testing.T, z mpc.GoZip) []string {
+	if !assert.NotNil(t, z) {
+		return nil
+	}
+	defer z.Close()
+	b, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	names := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestResolver_MultiModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newTestRepo(t, dir, "multi",
+		testRevision{
+			files: map[string]string{
+				"go.mod":         "module git.x/multi\n",
+				"LICENSE":        "license\n",
+				"a.go":           "package multi\n",
+				"sub/dir/go.mod": "module git.x/multi/sub/dir\n",
+				"sub/dir/s.go":   "package dir\n",
+			},
+			tag:  "v1.0.0",
+			when: testTime,
+		},
+		testRevision{
+			tag:  "sub/dir/v1.0.0",
+			when: testTime,
+		},
+		testRevision{
+			files: map[string]string{"v2/go.mod": "module git.x/multi/v2\n", "v2/x.go": "package multi\n"},
+			tag:   "v2.0.0",
+			when:  testTime.Add(time.Hour),
+		},
+		testRevision{
+			files: map[string]string{"sub/dir/go.mod": "module git.x/multi/sub/dir/v3\n"},
+			tag:   "sub/dir/v3.0.0",
+			when:  testTime.Add(2 * time.Hour),
+		},
+	)
+	s := &Resolver{Mapping: map[string]string{"git.x/": "file://" + dir + "/"}, Pool: NewPool(filepath.Join(dir, "pool"), time.Minute)}
+
+	assert.Equal(t, mpc.ParseVersions("v1.0.0"), s.Versions("git.x/multi"))
+	assert.Equal(t, []string{"git.x/multi@v1.0.0/LICENSE", "git.x/multi@v1.0.0/a.go", "git.x/multi@v1.0.0/go.mod"},
+		zipNames(t, s.Zip("git.x/multi", "v1.0.0")))
+
+	//major sub directory
+	assert.Equal(t, mpc.ParseVersions("v2.0.0"), s.Versions("git.x/multi/v2"))
+	assert.Equal(t, mpc.GoMod("module git.x/multi/v2\n"), s.Mod("git.x/multi/v2", "v2.0.0"))
+	assert.Equal(t, []string{"git.x/multi/v2@v2.0.0/LICENSE", "git.x/multi/v2@v2.0.0/go.mod", "git.x/multi/v2@v2.0.0/x.go"},
+		zipNames(t, s.Zip("git.x/multi/v2", "v2.0.0")))
+
+	//sub directory module with root LICENSE
+	assert.Equal(t, mpc.ParseVersions("v1.0.0"), s.Versions("git.x/multi/sub/dir"))
+	assert.Equal(t, mpc.GoMod("module git.x/multi/sub/dir\n"), s.Mod("git.x/multi/sub/dir", "v1.0.0"))
+	assert.Equal(t, []string{"git.x/multi/sub/dir@v1.0.0/LICENSE", "git.x/multi/sub/dir@v1.0.0/go.mod", "git.x/multi/sub/dir@v1.0.0/s.go"},
+		zipNames(t, s.Zip("git.x/multi/sub/dir", "v1.0.0")))
+
+	//major suffix declared in go.mod
+	assert.Equal(t, mpc.ParseVersions("v3.0.0"), s.Versions("git.x/multi/sub/dir/v3"))
+	assert.Equal(t, mpc.GoMod("module git.x/multi/sub/dir/v3\n"), s.Mod("git.x/multi/sub/dir/v3", "v3.0.0"))
+	assert.Equal(t, &mpc.Info{Version: "v3.0.0", Time: testTime.Add(2 * time.Hour)}, s.Info("git.x/multi/sub/dir/v3", mpc.LatestVersion))
+	assert.Nil(t, s.Info("git.x/multi/sub/dir", "v3.0.0"))
+	assert.Nil(t, s.Info("git.x/multi/sub/dir/v3", "v1.0.0"))
+}
+
+func TestResolver_Incompatible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newTestRepo(t, dir, "legacy",
+		testRevision{files: map[string]string{"a.go": "package legacy\n"}, tag: "v1.0.0", when: testTime},
+		testRevision{files: map[string]string{"b.go": "package legacy\n"}, tag: "v2.0.0", when: testTime.Add(time.Hour)},
+		testRevision{files: map[string]string{"c.go": "package legacy\n"}, tag: "v2.1.0", when: testTime.Add(2 * time.Hour)},
+	)
+	s := &Resolver{Mapping: map[string]string{"git.x/": "file://" + dir + "/"}, Pool: NewPool(filepath.Join(dir, "pool"), time.Minute)}
+
+	assert.Equal(t, mpc.ParseVersions("v1.0.0\nv2.0.0+incompatible\nv2.1.0+incompatible"), s.Versions("git.x/legacy"))
+	assert.Equal(t, &mpc.Info{Version: "v2.1.0+incompatible", Time: testTime.Add(2 * time.Hour)}, s.Info("git.x/legacy", mpc.LatestVersion))
+	assert.Equal(t, mpc.GoMod("module git.x/legacy\n"), s.Mod("git.x/legacy", "v2.0.0+incompatible"))
+	assert.Equal(t, []string{"git.x/legacy@v2.0.0+incompatible/a.go", "git.x/legacy@v2.0.0+incompatible/b.go"},
+		zipNames(t, s.Zip("git.x/legacy", "v2.0.0+incompatible")))
+	assert.Nil(t, s.Info("git.x/legacy", "v2.0.0"))
+	assert.Nil(t, s.Info("git.x/legacy/v2", "v2.0.0"))
+}
+
+func TestResolver_Context(t *testing.T) {
+	s := newTestResolver(t)
+	r := mpc.UpgradeResolver(s)
+	ctx := context.Background()
+	i, err := r.Info(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, mpc.Version("v1.0.0"), i.Version)
+	_, err = r.Info(ctx, "git.x/some", "v1.3.0")
+	assert.True(t, mpc.IsNotFound(err))
+	_, err = r.Mod(ctx, "other.x/some", "v1.0.0")
+	assert.True(t, mpc.IsNotFound(err))
+	_, err = r.Mod(ctx, "git.x/none", "v1.0.0")
+	assert.True(t, mpc.IsNotFound(err))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	dir, err := ioutil.TempDir("", "mpc_test_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s.Pool = NewPool(filepath.Join(dir, "pool"), time.Minute)
+	_, err = r.Versions(canceled, "git.x/some")
+	assert.NotNil(t, err)
+	assert.False(t, mpc.IsNotFound(err))
+}
@@ -0,0 +1,181 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/ZenLiuCN/mpc"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// CreateModuleZip write a module zip of files under dir, same as golang.org/x/mod/zip does:
+// 1. every entry is prefixed with module@version/
+// 2. nested modules (sub directories with go.mod), vendored packages, VCS directories, symbolic links and irregular files are omitted
+// 3. size limits of files, go.mod and LICENSE are enforced
+// version must be canonical.
+func CreateModuleZip(w io.Writer, mod mpc.Module, version mpc.Version, dir string) error {
+	return modzip.CreateFromDir(w, module.Version{Path: string(mod), Version: string(version)}, dir)
+}
+
+// CreateModuleZipOf write a module zip of an abstract list of files @see CreateModuleZip
+func CreateModuleZipOf(w io.Writer, mod mpc.Module, version mpc.Version, files []modzip.File) error {
+	return modzip.Create(w, module.Version{Path: string(mod), Version: string(version)}, files)
+}
+
+// CreateModuleZipFile create a module zip into a temporary file @see CreateModuleZip. the returned file is rewound to start.
+func CreateModuleZipFile(mod mpc.Module, version mpc.Version, dir string) (f *os.File, err error) {
+	return createTempZip(func(w io.Writer) error {
+		return CreateModuleZip(w, mod, version, dir)
+	})
+}
+
+// CreateModuleZipFileOf create a module zip of files into a temporary file @see CreateModuleZipOf. the returned file is rewound to start.
+func CreateModuleZipFileOf(mod mpc.Module, version mpc.Version, files []modzip.File) (f *os.File, err error) {
+	return createTempZip(func(w io.Writer) error {
+		return CreateModuleZipOf(w, mod, version, files)
+	})
+}
+
+func createTempZip(create func(w io.Writer) error) (f *os.File, err error) {
+	if f, err = ioutil.TempFile("", "temp_zip_*"); err != nil {
+		return nil, err
+	}
+	if err = create(f); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+//a file in git object storage
+type treeFile struct {
+	*object.File
+}
+
+func (t treeFile) Path() string {
+	return t.Name
+}
+
+func (t treeFile) Lstat() (os.FileInfo, error) {
+	m, err := t.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, err
+	}
+	return treeFileInfo{name: path.Base(t.Name), size: t.Size, mode: m}, nil
+}
+
+func (t treeFile) Open() (io.ReadCloser, error) {
+	return t.Reader()
+}
+
+type treeFileInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (t treeFileInfo) Name() string {
+	return t.name
+}
+
+func (t treeFileInfo) Size() int64 {
+	return t.size
+}
+
+func (t treeFileInfo) Mode() os.FileMode {
+	return t.mode
+}
+
+func (t treeFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (t treeFileInfo) IsDir() bool {
+	return t.mode.IsDir()
+}
+
+func (t treeFileInfo) Sys() interface{} {
+	return nil
+}
+
+//a module zip file, which is seekable and knows it's h1: hash
+type zipFile struct {
+	*os.File
+	hash string
+}
+
+//a zipFile with the hash computed from the file, which is empty if the file is not a valid module zip
+func newZipFile(f *os.File) zipFile {
+	return zipFile{f, hashZip(f.Name())}
+}
+
+func hashZip(file string) string {
+	h, err := dirhash.HashZip(file, dirhash.Hash1)
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+//hash of a module zip in memory, empty if it's not a valid module zip
+func hashZipBytes(b []byte) string {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return ""
+	}
+	files := make([]string, 0, len(r.File))
+	entries := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files = append(files, f.Name)
+		entries[f.Name] = f
+	}
+	h, err := dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return entries[name].Open()
+	})
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+func (z zipFile) Hash() string {
+	return z.hash
+}
+
+//a zipFile not closed by the receiver
+type unclosedZip struct {
+	zipFile
+}
+
+func (unclosedZip) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package git
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCreateModuleZipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_zip_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":             "module git.x/some\n",
+		"a.go":               "package some\n",
+		"inner/b.go":         "package inner\n",
+		"vendor/modules.txt": "# vendor\n",
+		"vendor/x/y/y.go":    "package y\n",
+		"sub/go.mod":         "module git.x/some/sub\n",
+		"sub/c.go":           "package sub\n",
+		".git/config":        "[core]\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.Nil(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "a.go"), filepath.Join(dir, "link.go")))
+
+	f, err := CreateModuleZipFile("git.x/some", "v1.0.0", dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	want := []string{
+		"git.x/some@v1.0.0/a.go",
+		"git.x/some@v1.0.0/go.mod",
+		"git.x/some@v1.0.0/inner/b.go",
+		"git.x/some@v1.0.0/vendor/modules.txt",
+	}
+	b, err := ioutil.ReadAll(f)
+	assert.Nil(t, err)
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	names := make([]string, 0, len(r.File))
+	for _, e := range r.File {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, want, names)
+
+	_, err = modzip.CheckZip(module.Version{Path: "git.x/some", Version: "v1.0.0"}, f.Name())
+	assert.Nil(t, err)
+
+	//the h1 hash is the same as hash of the raw module files
+	expect, err := dirhash.Hash1(want, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, filepath.FromSlash(name[len("git.x/some@v1.0.0/"):])))
+	})
+	assert.Nil(t, err)
+	h, err := dirhash.HashZip(f.Name(), dirhash.Hash1)
+	assert.Nil(t, err)
+	assert.Equal(t, expect, h)
+}
+
+func TestCreateModuleZipFile_NonCanonical(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpc_zip_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := CreateModuleZipFile("git.x/some", "v1.0", dir)
+	assert.NotNil(t, err)
+	assert.Nil(t, f)
+}
@@ -2,4 +2,7 @@ module github.com/ZenLiuCN/mpc
 
 go 1.14
 
-require github.com/stretchr/testify v1.7.0
+require (
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/mod v0.4.2
+)
@@ -19,77 +19,135 @@
 package mpc
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	pathPrefix = "/"
-	CacheAge   = 86400
+	//cache age of DefaultServer, copied by InitialHandler
+	CacheAge = 86400
 )
 
-// will call Initial
+// will call Initial of DefaultServer, with cache policy of CacheAge @see NewCachePolicy
 func InitialHandler(prefix string) {
 	if prefix != "" {
-		pathPrefix = prefix
+		DefaultServer.Prefix = prefix
 	}
+	DefaultServer.Cache = NewCachePolicy(CacheAge)
 	Initial()
 }
+
+// GoProxyHandler serve with DefaultServer
 func GoProxyHandler(w http.ResponseWriter, r *http.Request) {
-	re := res{w}
-	if strings.HasPrefix(r.URL.Path, pathPrefix) {
-		cmd := strings.TrimPrefix(r.URL.Path, pathPrefix)
-		m, v, c, s, p := CommandParser(cmd)
+	DefaultServer.ServeHTTP(w, r)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Logger != nil || s.Audit != nil || s.Metrics != nil {
+		start := time.Now()
+		aw := &accessWriter{ResponseWriter: w}
+		rec := new(servedBy)
+		r = r.WithContext(withServedBy(r.Context(), rec))
+		defer s.log(r, aw, rec, start)
+		w = aw
+	}
+	re := res{ResponseWriter: w, negative: s.Cache.Negative, head: r.Method == http.MethodHead}
+	if s.CORS != "" {
+		re.cors(s.CORS)
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		if s.CORS != "" {
+			re.preflight()
+			return
+		}
+		fallthrough
+	default:
+		re.notAllowed(s.CORS != "")
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, s.Prefix) {
+		cmd := strings.TrimPrefix(r.URL.Path, s.Prefix)
+		req, err := ParseRequest(cmd)
+		if err != nil {
+			re.invalid(err)
+			return
+		}
+		m, v, c, sc, p := req.Module, req.Version, req.Cmd, req.SumCmd, req.Param
+		re.age, re.immutable = s.Cache.Age(req)
+		if err := s.Policy.Check(req); err != nil {
+			re.denied(err)
+			return
+		}
+		ctx := r.Context()
 		switch c {
 		case CmdList:
-			i := ResolveVersions(m)
-			if i != "" {
-				re.okCache([]byte(i))
+			i, err := s.ResolveVersions(ctx, m)
+			if err != nil {
+				re.failure(err)
 				return
 			}
+			re.okCache([]byte(MergeVersions(s.Policy.Filter(m, i)).String()))
+			return
 		case CmdInfo, CmdLatest:
-			i := ResolveInfo(m, v)
-			if i != nil {
-				re.okCache(i.Marshal())
+			i, err := s.ResolveInfo(ctx, m, v)
+			if err != nil {
+				re.failure(err)
 				return
 			}
+			//the resolved version of a query
+			if err := s.Policy.CheckVersion(m, i.Version); err != nil {
+				re.denied(err)
+				return
+			}
+			re.lastModified(i.Time)
+			re.okCache(i.Marshal())
+			return
 		case CmdMod:
-			i := ResolveMod(m, v)
-			if i != "" {
-				re.okCache([]byte(i))
+			i, err := s.ResolveMod(ctx, m, v)
+			if err != nil {
+				re.failure(err)
 				return
 			}
+			re.okCache([]byte(i))
+			return
 		case CmdZip:
-			i := ResolveZip(m, v)
-			if i != nil {
-				re.okCacheReader(i)
+			i, err := s.ResolveZip(ctx, m, v)
+			if err != nil {
+				re.failure(err)
 				return
 			}
+			re.zip(r, i)
+			return
 		case CmdUndefined:
-			switch s {
+			switch sc {
 			case SumSupported:
-				if SumResolveSupported() {
+				if s.SumResolveSupported(req.SumDB) {
 					re.okCache(nil)
 					return
 				}
 			case SumLatest:
-				i := SumResolveLatest()
+				i := s.SumResolveLatest(req.SumDB)
 				if i != nil {
 					re.contentText()
 					re.okCache(i)
 					return
 				}
 			case SumLookup:
-				i := SumResolveLookup(m, v)
+				i := s.SumResolveLookup(req.SumDB, m, v)
 				if i != nil {
 					re.contentText()
 					re.okCache(i)
 					return
 				}
 			case SumTile:
-				i := SumResolveTile(p)
+				i := s.SumResolveTile(req.SumDB, p)
 				if i != nil {
 					re.contentStream()
 					re.okCache(i)
@@ -104,12 +162,87 @@ func GoProxyHandler(w http.ResponseWriter, r *http.Request) {
 
 type res struct {
 	http.ResponseWriter
+	//cache age of successful responses
+	age int
+	//successful responses are immutable
+	immutable bool
+	//cache age of 404 and 410
+	negative int
+	//response of HEAD, no content is written
+	head bool
+}
+
+const (
+	allowMethods     = "GET, HEAD"
+	corsAllowMethods = "GET, HEAD, OPTIONS"
+)
+
+func (r res) notAllowed(cors bool) {
+	if cors {
+		r.Header().Set("Allow", corsAllowMethods)
+	} else {
+		r.Header().Set("Allow", allowMethods)
+	}
+	r.WriteHeader(http.StatusMethodNotAllowed)
+}
+func (r res) cors(origin string) {
+	r.Header().Set("Access-Control-Allow-Origin", origin)
+	r.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, ETag, Last-Modified")
+	if origin != "*" {
+		r.Header().Add("Vary", "Origin")
+	}
+}
+//response of CORS preflight
+func (r res) preflight() {
+	r.Header().Set("Allow", corsAllowMethods)
+	r.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+	r.Header().Set("Access-Control-Allow-Headers", "If-None-Match, Range")
+	r.Header().Set("Access-Control-Max-Age", "86400")
+	r.WriteHeader(http.StatusNoContent)
 }
 
 func (r res) notFoundCache() {
-	r.writeCache(CacheAge)
+	r.writeCache(r.negative)
 	r.WriteHeader(404)
 }
+
+//404 with the reason of an invalid request
+func (r res) invalid(err error) {
+	r.contentText()
+	r.writeCache(r.negative)
+	r.WriteHeader(http.StatusNotFound)
+	if !r.head {
+		_, _ = r.Write([]byte(err.Error()))
+	}
+}
+
+//403 or 410 with the reason of a PolicyError, without cache as policy may change
+func (r res) denied(err error) {
+	status := http.StatusForbidden
+	if e, ok := err.(*PolicyError); ok {
+		status = e.Status
+	}
+	r.contentText()
+	r.writeCache(0)
+	r.WriteHeader(status)
+	if !r.head {
+		_, _ = r.Write([]byte(err.Error()))
+	}
+}
+
+//404 or 410 for UNKNOWN, 500 without cache for transient failures
+func (r res) failure(err error) {
+	switch {
+	case errors.Is(err, ErrGone):
+		r.writeCache(r.negative)
+		r.WriteHeader(http.StatusGone)
+	case errors.Is(err, ErrNotFound):
+		r.notFoundCache()
+	default:
+		r.writeCache(0)
+		r.WriteHeader(http.StatusInternalServerError)
+	}
+}
 func (r res) contentText() {
 	r.Header().Set("Content-Type", "text/plain; charset=utf-8")
 }
@@ -123,8 +256,26 @@ func (r res) writeCache(age int) {
 		r.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", age))
 	}
 }
+//cache headers of successful responses
+func (r res) writeOkCache() {
+	if r.immutable && r.age > 0 {
+		r.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", r.age))
+	} else {
+		r.writeCache(r.age)
+	}
+}
+func (r res) lastModified(t time.Time) {
+	if !t.IsZero() {
+		r.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
 func (r res) okCache(data []byte) {
-	r.writeCache(CacheAge)
+	r.writeOkCache()
+	r.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.head {
+		r.WriteHeader(http.StatusOK)
+		return
+	}
 	_, _ = r.Write(data)
 }
 func (r res) okNoCache(data []byte) {
@@ -134,16 +285,44 @@ func (r res) okNoCache(data []byte) {
 func (r res) ok(data []byte) {
 	_, _ = r.Write(data)
 }
-func (r res) okCacheReader(data io.ReadCloser) {
-	r.writeCache(CacheAge)
-	c := make([]byte, 0, 1024)
+//stream a zip, with Content-Length if size is known and a strong ETag if hash is known.
+//conditional and range requests are served when the zip is seekable, content is not read for HEAD.
+func (r res) zip(req *http.Request, data GoZip) {
 	defer data.Close()
-	n, err := data.Read(c)
-	if err != nil {
-		r.WriteHeader(500)
+	r.writeOkCache()
+	r.Header().Set("Content-Type", "application/zip")
+	etag := ""
+	if h, ok := data.(ZipHasher); ok {
+		if hash := h.Hash(); hash != "" {
+			etag = `"` + hash + `"`
+			r.Header().Set("ETag", etag)
+		}
+	}
+	if s, ok := data.(io.ReadSeeker); ok {
+		http.ServeContent(r, req, "", time.Time{}, s)
+		return
+	}
+	if etag != "" && matchETag(req.Header.Get("If-None-Match"), etag) {
+		r.WriteHeader(http.StatusNotModified)
+		return
 	}
-	for n > 0 {
-		_, _ = r.Write(c[:n])
-		n, err = data.Read(c)
+	if s, ok := data.(ZipSizer); ok && s.Size() >= 0 {
+		r.Header().Set("Content-Length", strconv.FormatInt(s.Size(), 10))
+	}
+	if r.head {
+		r.WriteHeader(http.StatusOK)
+		return
+	}
+	_, _ = io.Copy(r, data)
+}
+
+//if any of a If-None-Match header matches etag
+func matchETag(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,337 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	//default upper bounds of latency histograms in seconds
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// Metrics collect counters and histograms of resolvers and requests of a Server, set it to Server.Metrics and
+// serve it (as http.Handle("/metrics", metrics)) to expose in Prometheus text format.
+type Metrics struct {
+	//upper bounds of latency histograms in seconds, DefaultBuckets if nil
+	Buckets   []float64
+	lock      sync.Mutex
+	resolvers map[resolverLabels]*resolverMetric
+	requests  map[string]*histogram
+	codes     map[codeLabels]int64
+	bytes     map[resolverLabels]int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		resolvers: map[resolverLabels]*resolverMetric{},
+		requests:  map[string]*histogram{},
+		codes:     map[codeLabels]int64{},
+		bytes:     map[resolverLabels]int64{},
+	}
+}
+
+type resolverLabels struct {
+	resolver string
+	cmd      string
+}
+
+type codeLabels struct {
+	cmd  string
+	code int
+}
+
+//results of resolutions
+const (
+	resultHit      = "hit"
+	resultMiss     = "miss"
+	resultError    = "error"
+	resultCanceled = "canceled"
+)
+
+type resolverMetric struct {
+	results  map[string]int64
+	duration *histogram
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []int64
+	sum     float64
+	count   int64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (m *Metrics) histogram() *histogram {
+	buckets := m.Buckets
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+//observe a resolution of a resolver
+func (m *Metrics) resolved(resolver string, cmd Cmd, err error, d time.Duration) {
+	result := resultHit
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		result = resultCanceled
+	case IsNotFound(err):
+		result = resultMiss
+	default:
+		result = resultError
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.resolvers == nil {
+		m.resolvers = map[resolverLabels]*resolverMetric{}
+	}
+	k := resolverLabels{resolver, cmd.String()}
+	r, ok := m.resolvers[k]
+	if !ok {
+		r = &resolverMetric{results: map[string]int64{}, duration: m.histogram()}
+		m.resolvers[k] = r
+	}
+	r.results[result]++
+	r.duration.observe(d.Seconds())
+}
+
+//observe a served request
+func (m *Metrics) served(e *AccessEntry) {
+	cmd := e.Cmd
+	if cmd == "" {
+		cmd = e.SumCmd
+	}
+	if cmd == "" {
+		cmd = "Invalid"
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.requests == nil {
+		m.requests = map[string]*histogram{}
+		m.codes = map[codeLabels]int64{}
+		m.bytes = map[resolverLabels]int64{}
+	}
+	h, ok := m.requests[cmd]
+	if !ok {
+		h = m.histogram()
+		m.requests[cmd] = h
+	}
+	h.observe(e.Latency)
+	m.codes[codeLabels{cmd, e.Status}]++
+	m.bytes[resolverLabels{e.Resolver, cmd}] += e.Bytes
+}
+
+//region exposition
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "must-revalidate, no-cache, no-store")
+	_ = m.Write(w)
+}
+
+// Write all metrics in Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	b := new(strings.Builder)
+	m.lock.Lock()
+	resolvers := make([]resolverLabels, 0, len(m.resolvers))
+	for k := range m.resolvers {
+		resolvers = append(resolvers, k)
+	}
+	sortResolverLabels(resolvers)
+
+	b.WriteString("# HELP mpc_resolver_requests_total Resolutions of resolvers by result (hit, miss, error, canceled).\n")
+	b.WriteString("# TYPE mpc_resolver_requests_total counter\n")
+	for _, k := range resolvers {
+		for _, result := range []string{resultHit, resultMiss, resultError, resultCanceled} {
+			writeSample(b, "mpc_resolver_requests_total", m.resolvers[k].results[result],
+				"resolver", k.resolver, "cmd", k.cmd, "result", result)
+		}
+	}
+	b.WriteString("# HELP mpc_resolver_hit_ratio Ratio of hits to hits and misses of resolvers, the cache hit ratio of a caching resolver.\n")
+	b.WriteString("# TYPE mpc_resolver_hit_ratio gauge\n")
+	for _, k := range resolvers {
+		r := m.resolvers[k]
+		ratio := 0.0
+		if n := r.results[resultHit] + r.results[resultMiss]; n > 0 {
+			ratio = float64(r.results[resultHit]) / float64(n)
+		}
+		writeSample(b, "mpc_resolver_hit_ratio", ratio, "resolver", k.resolver, "cmd", k.cmd)
+	}
+	b.WriteString("# HELP mpc_resolver_duration_seconds Latency of resolutions of resolvers.\n")
+	b.WriteString("# TYPE mpc_resolver_duration_seconds histogram\n")
+	for _, k := range resolvers {
+		writeHistogram(b, "mpc_resolver_duration_seconds", m.resolvers[k].duration, "resolver", k.resolver, "cmd", k.cmd)
+	}
+
+	cmds := make([]string, 0, len(m.requests))
+	for cmd := range m.requests {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+	b.WriteString("# HELP mpc_requests_total Served requests by command and status code.\n")
+	b.WriteString("# TYPE mpc_requests_total counter\n")
+	codes := make([]codeLabels, 0, len(m.codes))
+	for k := range m.codes {
+		codes = append(codes, k)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].cmd != codes[j].cmd {
+			return codes[i].cmd < codes[j].cmd
+		}
+		return codes[i].code < codes[j].code
+	})
+	for _, k := range codes {
+		writeSample(b, "mpc_requests_total", m.codes[k], "cmd", k.cmd, "code", strconv.Itoa(k.code))
+	}
+	b.WriteString("# HELP mpc_request_duration_seconds Latency of served requests by command.\n")
+	b.WriteString("# TYPE mpc_request_duration_seconds histogram\n")
+	for _, cmd := range cmds {
+		writeHistogram(b, "mpc_request_duration_seconds", m.requests[cmd], "cmd", cmd)
+	}
+	b.WriteString("# HELP mpc_response_bytes_total Bytes of response bodies by serving resolver and command.\n")
+	b.WriteString("# TYPE mpc_response_bytes_total counter\n")
+	bytes := make([]resolverLabels, 0, len(m.bytes))
+	for k := range m.bytes {
+		bytes = append(bytes, k)
+	}
+	sortResolverLabels(bytes)
+	for _, k := range bytes {
+		writeSample(b, "mpc_response_bytes_total", m.bytes[k], "resolver", k.resolver, "cmd", k.cmd)
+	}
+	m.lock.Unlock()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortResolverLabels(labels []resolverLabels) {
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].resolver != labels[j].resolver {
+			return labels[i].resolver < labels[j].resolver
+		}
+		return labels[i].cmd < labels[j].cmd
+	})
+}
+
+func writeHistogram(b *strings.Builder, name string, h *histogram, labels ...string) {
+	for i, bound := range h.buckets {
+		writeSample(b, name+"_bucket", h.counts[i], append(labels, "le", formatFloat(bound))...)
+	}
+	writeSample(b, name+"_bucket", h.count, append(labels, "le", "+Inf")...)
+	writeSample(b, name+"_sum", h.sum, labels...)
+	writeSample(b, name+"_count", h.count, labels...)
+}
+
+//write a sample with label pairs
+func writeSample(b *strings.Builder, name string, value interface{}, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	switch v := value.(type) {
+	case float64:
+		b.WriteString(formatFloat(v))
+	default:
+		fmt.Fprint(b, v)
+	}
+	b.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+//endregion
+
+//region metered resolver
+
+//a resolver observed by Metrics with it's registered name
+type meteredResolver struct {
+	ResolverV2
+	name    string
+	metrics *Metrics
+}
+
+func (r meteredResolver) Versions(ctx context.Context, module Module) (Versions, error) {
+	start := time.Now()
+	v, err := r.ResolverV2.Versions(ctx, module)
+	r.metrics.resolved(r.name, CmdList, err, time.Since(start))
+	return v, err
+}
+
+func (r meteredResolver) Info(ctx context.Context, module Module, version Version) (*Info, error) {
+	start := time.Now()
+	v, err := r.ResolverV2.Info(ctx, module, version)
+	cmd := CmdInfo
+	if version == LatestVersion {
+		cmd = CmdLatest
+	}
+	r.metrics.resolved(r.name, cmd, err, time.Since(start))
+	return v, err
+}
+
+func (r meteredResolver) Mod(ctx context.Context, module Module, version Version) (GoMod, error) {
+	start := time.Now()
+	v, err := r.ResolverV2.Mod(ctx, module, version)
+	r.metrics.resolved(r.name, CmdMod, err, time.Since(start))
+	return v, err
+}
+
+func (r meteredResolver) Zip(ctx context.Context, module Module, version Version) (GoZip, error) {
+	start := time.Now()
+	v, err := r.ResolverV2.Zip(ctx, module, version)
+	r.metrics.resolved(r.name, CmdZip, err, time.Since(start))
+	return v, err
+}
+
+//endregion
@@ -0,0 +1,82 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	s := NewServer("/", 60)
+	s.Metrics = NewMetrics()
+	s.Metrics.Buckets = []float64{0.5, 60}
+	assert.Nil(t, s.RegisterResolver("zip", 0, func(...Resolver) Resolver {
+		return zipResolver{}
+	}))
+	assert.Nil(t, s.RegisterResolverV2(`failed "x"`, 1, func(...ResolverV2) ResolverV2 {
+		return failedResolver{errors.New("transient")}
+	}))
+	assert.Nil(t, s.RegisterResolver("list", 2, func(...Resolver) Resolver {
+		return JustTestResolver(0)
+	}))
+	s.Initial()
+	for _, path := range []string{
+		"/git.x/some/@v/v1.0.0.zip",
+		"/git.x/some/@v/v1.0.0.zip",
+		"/git.x/some/@v/list",
+		"/git.x/some/@v/v1.0.0.mod",
+		"/invalid",
+	} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	s.Metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE mpc_resolver_requests_total counter",
+		`mpc_resolver_requests_total{resolver="zip",cmd="CmdZip",result="hit"} 2`,
+		`mpc_resolver_requests_total{resolver="zip",cmd="CmdList",result="miss"} 1`,
+		`mpc_resolver_requests_total{resolver="list",cmd="CmdList",result="hit"} 1`,
+		`mpc_resolver_requests_total{resolver="failed \"x\"",cmd="CmdList",result="error"} 1`,
+		`mpc_resolver_hit_ratio{resolver="zip",cmd="CmdList"} 0`,
+		`mpc_resolver_hit_ratio{resolver="zip",cmd="CmdZip"} 1`,
+		`mpc_resolver_duration_seconds_bucket{resolver="zip",cmd="CmdZip",le="60"} 2`,
+		`mpc_resolver_duration_seconds_bucket{resolver="zip",cmd="CmdZip",le="+Inf"} 2`,
+		`mpc_resolver_duration_seconds_count{resolver="zip",cmd="CmdZip"} 2`,
+		`mpc_requests_total{cmd="CmdZip",code="200"} 2`,
+		`mpc_requests_total{cmd="Invalid",code="404"} 1`,
+		`mpc_request_duration_seconds_count{cmd="CmdList"} 1`,
+		`mpc_response_bytes_total{resolver="list",cmd="CmdList"} 5`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			assert.Len(t, strings.Fields(line[strings.LastIndex(line, "}")+1:]), 1, line)
+		}
+	}
+}
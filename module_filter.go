@@ -0,0 +1,43 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"golang.org/x/mod/module"
+)
+
+// ModuleFilter select modules by path patterns, patterns are comma separated globs as GOPRIVATE and GONOPROXY,
+// which match path prefixes, eg: "*.corp.example.com,github.com/corp".
+type ModuleFilter struct {
+	//only matched modules are selected, all modules if empty
+	Include string
+	//matched modules are not selected, as GONOSUMDB for a checksum resolver
+	Exclude string
+}
+
+// Match the module, an undefined module (as checksum database commands without module) is always matched
+func (f ModuleFilter) Match(m Module) bool {
+	if m == UndefinedModule {
+		return true
+	}
+	if f.Include != "" && !module.MatchPrefixPatterns(f.Include, string(m)) {
+		return false
+	}
+	return f.Exclude == "" || !module.MatchPrefixPatterns(f.Exclude, string(m))
+}
@@ -0,0 +1,92 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+//a resolver counts calls
+type countingResolver struct {
+	failedResolver
+	calls *int32
+}
+
+func (c countingResolver) Mod(context.Context, Module, Version) (GoMod, error) {
+	atomic.AddInt32(c.calls, 1)
+	return "", ErrNotFound
+}
+
+func TestModuleFilter(t *testing.T) {
+	f := ModuleFilter{Include: "*.corp,git.x/private", Exclude: "git.x/private/public"}
+	for m, matched := range map[Module]bool{
+		"git.corp/some":            true,
+		"git.x/private":            true,
+		"git.x/private/sub":        true,
+		"git.x/private/public/sub": false,
+		"git.x/privates":           false,
+		"github.com/ZenLiuCN/mpc":  false,
+		UndefinedModule:            true,
+	} {
+		assert.Equal(t, matched, f.Match(m), m)
+	}
+	assert.True(t, ModuleFilter{}.Match("git.x/any"))
+	assert.False(t, ModuleFilter{Exclude: "git.x"}.Match("git.x/any"))
+}
+
+func TestServer_Filter(t *testing.T) {
+	var private, public int32
+	s := NewServer("/", 60)
+	assert.Nil(t, s.RegisterResolverV2("private", 0, func(...ResolverV2) ResolverV2 {
+		return countingResolver{failedResolver{ErrNotFound}, &private}
+	}))
+	assert.Nil(t, s.RegisterResolverV2("public", 1, func(...ResolverV2) ResolverV2 {
+		return countingResolver{failedResolver{ErrNotFound}, &public}
+	}))
+	assert.Nil(t, s.SetResolverFilter(0, ModuleFilter{Include: "git.x"}))
+	assert.Nil(t, s.SetResolverFilter(1, ModuleFilter{Exclude: "git.x"}))
+	assert.NotNil(t, s.SetResolverFilter(2, ModuleFilter{}))
+	s.Initial()
+	ctx := context.Background()
+	_, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.True(t, IsNotFound(err))
+	_, err = s.ResolveMod(ctx, "github.com/some/some", "v1.0.0")
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&private))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&public))
+
+	//checksum lookup of excluded modules
+	assert.Nil(t, s.RegisterCheckSumResolverFor("sum.x", 0, namedCheckSum("x")))
+	assert.Nil(t, s.SetCheckSumResolverFilter(0, ModuleFilter{Exclude: "git.x"}))
+	assert.NotNil(t, s.SetCheckSumResolverFilter(1, ModuleFilter{}))
+	s.Initial()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, get("/sumdb/sum.x/lookup/git.x/some@v1.0.0").Code)
+	assert.Equal(t, http.StatusOK, get("/sumdb/sum.x/lookup/github.com/some/some@v1.0.0").Code)
+	assert.Equal(t, http.StatusOK, get("/sumdb/sum.x/latest").Code)
+}
@@ -0,0 +1,252 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"fmt"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"net/http"
+	"strings"
+)
+
+// PolicyRule allow or deny modules matched by Pattern, and constrain versions of them.
+type PolicyRule struct {
+	//module path patterns, comma separated globs as GOPRIVATE
+	Pattern string
+	//deny matched modules entirely
+	Deny bool
+	//allowed versions, comparisons (=, !=, >, >=, <, <=) separated by spaces are all required,
+	//alternatives are separated by "||", as ">=v1.2.0 <v2.0.0 || >=v2.1.0", empty allows all versions.
+	Versions string
+	//forbid pre-release versions, pseudo-versions are pre-releases too
+	NoPrerelease bool
+	//status of denied requests, http.StatusForbidden or http.StatusGone, default is http.StatusForbidden
+	Status int
+	//reason printed by go command, a default reason is used if empty
+	Reason   string
+	versions VersionConstraint
+}
+
+// Policy is a list of rules evaluated before resolution, the first rule matches the module applies,
+// modules not matched by any rule are allowed.
+type Policy struct {
+	rules []PolicyRule
+}
+
+// NewPolicy validate rules and version constraints
+func NewPolicy(rules ...PolicyRule) (*Policy, error) {
+	p := &Policy{rules: make([]PolicyRule, 0, len(rules))}
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("policy rule without pattern")
+		}
+		switch rule.Status {
+		case 0:
+			rule.Status = http.StatusForbidden
+		case http.StatusForbidden, http.StatusGone:
+		default:
+			return nil, fmt.Errorf("policy rule of %q: status %d is not 403 or 410", rule.Pattern, rule.Status)
+		}
+		c, err := ParseVersionConstraint(rule.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule of %q: %w", rule.Pattern, err)
+		}
+		rule.versions = c
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// PolicyError is a request denied by Policy
+type PolicyError struct {
+	Module  Module
+	Version Version
+	//403 or 410
+	Status int
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+//the rule applies to module, nil if none
+func (p *Policy) rule(m Module) *PolicyRule {
+	if p == nil {
+		return nil
+	}
+	for i := range p.rules {
+		if module.MatchPrefixPatterns(p.rules[i].Pattern, string(m)) {
+			return &p.rules[i]
+		}
+	}
+	return nil
+}
+
+// CheckModule returns a PolicyError if the module is denied
+func (p *Policy) CheckModule(m Module) error {
+	r := p.rule(m)
+	if r == nil || !r.Deny {
+		return nil
+	}
+	return r.denied(m, UndefinedVersion, fmt.Sprintf("module %s is denied by policy", m))
+}
+
+// CheckVersion returns a PolicyError if the module or the version is denied.
+// version which is not a semantic version (as a branch) is only checked for the module.
+func (p *Policy) CheckVersion(m Module, v Version) error {
+	r := p.rule(m)
+	if r == nil {
+		return nil
+	}
+	if r.Deny {
+		return r.denied(m, v, fmt.Sprintf("module %s is denied by policy", m))
+	}
+	if !semver.IsValid(string(v)) {
+		return nil
+	}
+	if r.NoPrerelease && semver.Prerelease(string(v)) != "" {
+		return r.denied(m, v, fmt.Sprintf("pre-release version %s of module %s is denied by policy", v, m))
+	}
+	if !r.versions.Allows(v) {
+		return r.denied(m, v, fmt.Sprintf("version %s of module %s is not in allowed versions %q", v, m, r.Versions))
+	}
+	return nil
+}
+
+// Check a request before resolution, checksum database commands are not checked.
+func (p *Policy) Check(r Request) error {
+	switch r.Cmd {
+	case CmdList, CmdLatest:
+		return p.CheckModule(r.Module)
+	case CmdInfo, CmdMod, CmdZip:
+		return p.CheckVersion(r.Module, r.Version)
+	default:
+		return nil
+	}
+}
+
+// Filter versions of module allowed by policy
+func (p *Policy) Filter(m Module, versions Versions) Versions {
+	if p.rule(m) == nil {
+		return versions
+	}
+	var allowed Versions
+	for _, v := range versions {
+		if p.CheckVersion(m, v) == nil {
+			allowed = append(allowed, v)
+		}
+	}
+	return allowed
+}
+
+func (r *PolicyRule) denied(m Module, v Version, reason string) error {
+	if r.Reason != "" {
+		reason = r.Reason
+	}
+	return &PolicyError{Module: m, Version: v, Status: r.Status, Reason: reason}
+}
+
+//region version constraint
+
+// VersionConstraint is alternatives of all required comparisons @see ParseVersionConstraint
+type VersionConstraint [][]versionComparison
+
+type versionComparison struct {
+	op      string
+	version string
+}
+
+// ParseVersionConstraint parse comparisons (=, !=, >, >=, <, <=, no operator is =) of semantic versions
+// separated by spaces, alternatives are separated by "||", as ">=v1.2.0 <v2.0.0 || v2.1.0". empty constraint allows all.
+func ParseVersionConstraint(constraint string) (VersionConstraint, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return nil, nil
+	}
+	var c VersionConstraint
+	for _, alternative := range strings.Split(constraint, "||") {
+		fields := strings.Fields(alternative)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty alternative of version constraint %q", constraint)
+		}
+		comparisons := make([]versionComparison, 0, len(fields))
+		for _, field := range fields {
+			v := strings.TrimLeft(field, "<>=!")
+			op := field[:len(field)-len(v)]
+			switch op {
+			case "":
+				op = "="
+			case "=", "!=", ">", ">=", "<", "<=":
+			default:
+				return nil, fmt.Errorf("unknown operator %q of version constraint %q", op, constraint)
+			}
+			if !semver.IsValid(v) {
+				return nil, fmt.Errorf("invalid version %q of version constraint %q", v, constraint)
+			}
+			comparisons = append(comparisons, versionComparison{op, v})
+		}
+		c = append(c, comparisons)
+	}
+	return c, nil
+}
+
+// Allows a semantic version, versions in other form are not allowed unless the constraint is empty
+func (c VersionConstraint) Allows(version Version) bool {
+	if len(c) == 0 {
+		return true
+	}
+	v := string(version)
+	if !semver.IsValid(v) {
+		return false
+	}
+	for _, comparisons := range c {
+		allowed := true
+		for _, cmp := range comparisons {
+			if !cmp.allows(v) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (c versionComparison) allows(v string) bool {
+	n := semver.Compare(v, c.version)
+	switch c.op {
+	case "=":
+		return n == 0
+	case "!=":
+		return n != 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	default:
+		return n <= 0
+	}
+}
+
+//endregion
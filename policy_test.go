@@ -0,0 +1,105 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseVersionConstraint(t *testing.T) {
+	c, err := ParseVersionConstraint(">=v1.2.0 <v2.0.0 || v2.1.0 || >v3 !=v3.0.1")
+	assert.Nil(t, err)
+	for v, allowed := range map[Version]bool{
+		"v1.1.9":              false,
+		"v1.2.0":              true,
+		"v1.9.9-rc.1":         true,
+		"v2.0.0":              false,
+		"v2.1.0":              true,
+		"v3.0.0":              false,
+		"v3.0.1":              false,
+		"v3.0.2":              true,
+		"v4.0.0+incompatible": true,
+		"master":              false,
+	} {
+		assert.Equal(t, allowed, c.Allows(v), v)
+	}
+	c, err = ParseVersionConstraint(" ")
+	assert.Nil(t, err)
+	assert.True(t, c.Allows("master"))
+	for _, s := range []string{">=1.2.0", "~v1.2.0", ">=v1.2.0 ||", "=>v1.0.0"} {
+		_, err = ParseVersionConstraint(s)
+		assert.NotNil(t, err, s)
+	}
+	_, err = NewPolicy(PolicyRule{Pattern: "git.x", Status: http.StatusNotFound})
+	assert.NotNil(t, err)
+	_, err = NewPolicy(PolicyRule{Versions: "v1.0.0"})
+	assert.NotNil(t, err)
+}
+
+func TestServer_Policy(t *testing.T) {
+	p, err := NewPolicy(
+		PolicyRule{Pattern: "git.x/blocked/allowed"},
+		PolicyRule{Pattern: "git.x/blocked", Deny: true, Reason: "git.x/blocked is not licensed"},
+		PolicyRule{Pattern: "git.x/gone", Deny: true, Status: http.StatusGone},
+		PolicyRule{Pattern: "git.x/pinned", Versions: ">=v1.1.0 <v2.0.0"},
+		PolicyRule{Pattern: "*.corp/stable", NoPrerelease: true},
+	)
+	if !assert.Nil(t, err) {
+		return
+	}
+	s := NewServer("/", 60)
+	s.Policy = p
+	s.resolvers = []ResolverV2{
+		versionsResolver{failedResolver{ErrNotFound}, Versions{"v1.0.0", "v1.1.0-rc.1", "v1.1.0", "v2.0.0"}},
+		UpgradeResolver(infoResolver{}),
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	for path, status := range map[string]int{
+		"/git.x/blocked/@v/list":                http.StatusForbidden,
+		"/git.x/blocked/sub/@v/v1.0.0.zip":      http.StatusForbidden,
+		"/git.x/blocked/allowed/@v/v1.0.0.mod":  http.StatusOK,
+		"/git.x/gone/@latest":                   http.StatusGone,
+		"/git.x/pinned/@v/v1.0.0.zip":           http.StatusForbidden,
+		"/git.x/pinned/@v/v1.1.0.mod":           http.StatusOK,
+		"/git.x/pinned/@v/master.info":          http.StatusForbidden,
+		"/git.x/pinned/@latest":                 http.StatusForbidden,
+		"/git.corp/stable/@v/v1.1.0-rc.1.mod":   http.StatusForbidden,
+		"/git.corp/stable/@v/v1.1.0.mod":        http.StatusOK,
+		"/git.corp/unstable/@v/v1.1.0-rc.1.mod": http.StatusOK,
+		"/sumdb/sum.x/lookup/git.x/gone@v1.0.0": http.StatusNotFound,
+	} {
+		assert.Equal(t, status, get(path).Code, path)
+	}
+	w := get("/git.x/blocked/@v/v1.0.0.info")
+	assert.Equal(t, "git.x/blocked is not licensed", w.Body.String())
+	assert.Equal(t, "must-revalidate, no-cache, no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, `version v1.0.0 of module git.x/pinned is not in allowed versions ">=v1.1.0 <v2.0.0"`, get("/git.x/pinned/@v/v1.0.0.mod").Body.String())
+
+	//versions are filtered
+	assert.Equal(t, "v1.1.0", get("/git.x/pinned/@v/list").Body.String())
+	assert.Equal(t, "v1.0.0\nv1.1.0\nv2.0.0", get("/git.corp/stable/@v/list").Body.String())
+	assert.Equal(t, "v1.0.0\nv1.1.0-rc.1\nv1.1.0\nv2.0.0", get("/git.x/other/@v/list").Body.String())
+}
@@ -0,0 +1,108 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/mod/semver"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PseudoVersionTimestampFormat = "20060102150405"
+
+var (
+	pseudoVersionRE             = regexp.MustCompile(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	ErrNotPseudoVersion         = errors.New("not a pseudo-version")
+	ErrInvalidPseudoVersionBase = errors.New("invalid pseudo-version base")
+)
+
+// PseudoVersion build a pseudo-version the same as go command does.
+// major is the major version of module path (eg: v2 for a /v2 module, empty for v0 or v1),
+// base is the highest semver tag of ancestor commits (may be empty), t is the commit time and rev is the commit hash.
+//
+//	vX.0.0-yyyymmddhhmmss-abcdefabcdef      without base
+//	vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdefabcdef  base is a release vX.Y.Z
+//	vX.Y.Z-pre.0.yyyymmddhhmmss-abcdefabcdef  base is a pre-release vX.Y.Z-pre
+func PseudoVersion(major string, base Version, t time.Time, rev string) (Version, error) {
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	segment := fmt.Sprintf("%s-%s", t.UTC().Format(PseudoVersionTimestampFormat), rev)
+	if base == UndefinedVersion {
+		if major == "" {
+			major = "v0"
+		}
+		return Version(major + ".0.0-" + segment), nil
+	}
+	b := string(base)
+	if !semver.IsValid(b) {
+		return UndefinedVersion, ErrInvalidPseudoVersionBase
+	}
+	build := semver.Build(b)
+	b = strings.TrimSuffix(b, build)
+	if semver.Prerelease(b) != "" {
+		return Version(b + ".0." + segment + build), nil
+	}
+	i := strings.LastIndex(b, ".")
+	patch, err := strconv.ParseUint(b[i+1:], 10, 64)
+	if err != nil {
+		return UndefinedVersion, ErrInvalidPseudoVersionBase
+	}
+	return Version(fmt.Sprintf("%s.%d-0.%s%s", b[:i], patch+1, segment, build)), nil
+}
+
+// IsPseudoVersion reports whether v is a pseudo-version
+func IsPseudoVersion(v Version) bool {
+	return strings.Count(string(v), "-") >= 2 && semver.IsValid(string(v)) && pseudoVersionRE.MatchString(string(v))
+}
+
+// PseudoVersionRev the revision part of a pseudo-version
+func PseudoVersionRev(v Version) (rev string, err error) {
+	_, rev, err = parsePseudoVersion(v)
+	return
+}
+
+// PseudoVersionTime the commit time part of a pseudo-version
+func PseudoVersionTime(v Version) (time.Time, error) {
+	timestamp, _, err := parsePseudoVersion(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(PseudoVersionTimestampFormat, timestamp)
+}
+
+func parsePseudoVersion(v Version) (timestamp, rev string, err error) {
+	if !IsPseudoVersion(v) {
+		return "", "", ErrNotPseudoVersion
+	}
+	s := strings.TrimSuffix(string(v), semver.Build(string(v)))
+	j := strings.LastIndex(s, "-")
+	rev = s[j+1:]
+	s = s[:j]
+	i := strings.LastIndex(s, "-")
+	if k := strings.LastIndex(s, "."); k > i {
+		i = k
+	}
+	timestamp = s[i+1:]
+	return
+}
@@ -0,0 +1,60 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPseudoVersion(t *testing.T) {
+	at := time.Date(2021, 10, 10, 10, 10, 10, 0, time.FixedZone("X", 3600))
+	rev := "abcdef1234567890abcdef1234567890abcdef12"
+	tests := []struct {
+		major string
+		base  Version
+		want  Version
+	}{
+		{"", "", "v0.0.0-20211010091010-abcdef123456"},
+		{"v2", "", "v2.0.0-20211010091010-abcdef123456"},
+		{"", "v1.2.3", "v1.2.4-0.20211010091010-abcdef123456"},
+		{"", "v1.2.3-pre", "v1.2.3-pre.0.20211010091010-abcdef123456"},
+		{"", "v2.0.0+incompatible", "v2.0.1-0.20211010091010-abcdef123456+incompatible"},
+	}
+	for _, tt := range tests {
+		got, err := PseudoVersion(tt.major, tt.base, at, rev)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, got)
+		assert.True(t, IsPseudoVersion(got))
+		r, err := PseudoVersionRev(got)
+		assert.Nil(t, err)
+		assert.Equal(t, "abcdef123456", r)
+		tm, err := PseudoVersionTime(got)
+		assert.Nil(t, err)
+		assert.True(t, at.Equal(tm), "%s != %s", at, tm)
+	}
+	_, err := PseudoVersion("", "1.2", at, rev)
+	assert.Equal(t, ErrInvalidPseudoVersionBase, err)
+	assert.False(t, IsPseudoVersion("v1.2.3"))
+	assert.False(t, IsPseudoVersion("v1.2.3-pre"))
+	_, err = PseudoVersionRev("v1.2.3")
+	assert.Equal(t, ErrNotPseudoVersion, err)
+}
@@ -0,0 +1,160 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+)
+
+//a Resolver provides a ResolverV2 of itself
+type contextual interface {
+	Context() ResolverV2
+}
+
+// UpgradeResolver adapt a Resolver as ResolverV2: UNKNOWN results are reported as ErrNotFound,
+// and a canceled context is checked before calling the Resolver.
+// if the Resolver has a method `Context() ResolverV2`, the provided ResolverV2 is used.
+func UpgradeResolver(resolver Resolver) ResolverV2 {
+	if c, ok := resolver.(contextual); ok {
+		return c.Context()
+	}
+	return upgraded{resolver}
+}
+
+// DowngradeResolver adapt a ResolverV2 as Resolver, with context.Background and errors are reported as UNKNOWN.
+func DowngradeResolver(resolver ResolverV2) Resolver {
+	if u, ok := resolver.(upgraded); ok {
+		return u.Resolver
+	}
+	return downgraded{resolver}
+}
+
+// UpgradeResolverFactory @see UpgradeResolver
+func UpgradeResolverFactory(factory ResolverFactory) ResolverV2Factory {
+	return func(resolvers ...ResolverV2) ResolverV2 {
+		r := make([]Resolver, 0, len(resolvers))
+		for _, resolver := range resolvers {
+			r = append(r, DowngradeResolver(resolver))
+		}
+		return UpgradeResolver(factory(r...))
+	}
+}
+
+// DowngradeResolverFactory @see DowngradeResolver
+func DowngradeResolverFactory(factory ResolverV2Factory) ResolverFactory {
+	return func(resolvers ...Resolver) Resolver {
+		r := make([]ResolverV2, 0, len(resolvers))
+		for _, resolver := range resolvers {
+			r = append(r, UpgradeResolver(resolver))
+		}
+		return DowngradeResolver(factory(r...))
+	}
+}
+
+//region upgraded
+
+type upgraded struct {
+	Resolver
+}
+
+func (u upgraded) Versions(ctx context.Context, module Module) (Versions, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := u.Resolver.Versions(module); len(v) > 0 {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (u upgraded) Info(ctx context.Context, module Module, version Version) (*Info, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := u.Resolver.Info(module, version); v != nil {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (u upgraded) Mod(ctx context.Context, module Module, version Version) (GoMod, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if v := u.Resolver.Mod(module, version); v != "" {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+func (u upgraded) Zip(ctx context.Context, module Module, version Version) (GoZip, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := u.Resolver.Zip(module, version); v != nil {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+
+//endregion
+
+//region downgraded
+
+type downgraded struct {
+	ResolverV2
+}
+
+func (d downgraded) Context() ResolverV2 {
+	return d.ResolverV2
+}
+
+func (d downgraded) Versions(module Module) Versions {
+	v, err := d.ResolverV2.Versions(context.Background(), module)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (d downgraded) Info(module Module, version Version) *Info {
+	v, err := d.ResolverV2.Info(context.Background(), module, version)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (d downgraded) Mod(module Module, version Version) GoMod {
+	v, err := d.ResolverV2.Mod(context.Background(), module, version)
+	if err != nil {
+		return ""
+	}
+	return v
+}
+
+func (d downgraded) Zip(module Module, version Version) GoZip {
+	v, err := d.ResolverV2.Zip(context.Background(), module, version)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+//endregion
@@ -0,0 +1,69 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+//a ResolverV2 always fails with error
+type failedResolver struct {
+	err error
+}
+
+func (f failedResolver) Versions(context.Context, Module) (Versions, error) {
+	return nil, f.err
+}
+
+func (f failedResolver) Info(context.Context, Module, Version) (*Info, error) {
+	return nil, f.err
+}
+
+func (f failedResolver) Mod(context.Context, Module, Version) (GoMod, error) {
+	return "", f.err
+}
+
+func (f failedResolver) Zip(context.Context, Module, Version) (GoZip, error) {
+	return nil, f.err
+}
+
+func TestUpgradeResolver(t *testing.T) {
+	ctx := context.Background()
+	u := UpgradeResolver(JustTestResolver(0))
+	v, err := u.Versions(ctx, "git.x/some")
+	assert.Nil(t, err)
+	assert.Equal(t, ParseVersions("1\n2\n3"), v)
+	assert.Equal(t, JustTestResolver(0), DowngradeResolver(u))
+
+	u = UpgradeResolver(DowngradeResolver(failedResolver{ErrNotFound}))
+	_, err = u.Mod(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, ErrNotFound, err)
+
+	//not found of Resolver
+	u = UpgradeResolver(zipResolver{})
+	_, err = u.Info(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, ErrNotFound, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = u.Mod(canceled, "git.x/some", "v1.0.0")
+	assert.Equal(t, context.Canceled, err)
+}
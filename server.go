@@ -0,0 +1,483 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server is a GO PROXY server owns it's resolver chain, checksum resolver chain, path prefix and cache policy.
+// register resolvers then call Initial before serving, Server is a http.Handler.
+type Server struct {
+	//path prefix of proxy, default is "/"
+	Prefix string
+	//Cache-Control of responses
+	Cache CachePolicy
+	//allowed origin of CORS (as "*"), OPTIONS and CORS headers are disabled when empty
+	CORS string
+	//resolve concurrently by tiers, resolvers are queried one by one when nil
+	Strategy *ParallelStrategy
+	//union versions from all resolvers for list, else the first answer is used
+	MergeVersions bool
+	//coalesce identical concurrent resolutions into one, a zip is shared to callers by a temporary file
+	Coalesce bool
+	//log served requests when not nil
+	Logger AccessLogger
+	//log zip downloads (GET with 200 or 206) of private modules (matched by Private) when not nil @see OpenAuditLog
+	Audit AccessLogger
+	//private module path patterns, comma separated globs as GOPRIVATE
+	Private string
+	//observe resolvers and requests when not nil
+	Metrics *Metrics
+	//deny modules and versions before resolution when not nil @see NewPolicy
+	Policy        *Policy
+	lock          sync.Mutex
+	flights       flightGroup
+	names         map[int]string
+	factories     map[int]ResolverV2Factory
+	filters       map[int]ModuleFilter
+	resolverIndex []int
+	checksum      map[int]CheckSumResolver
+	checkSumNames map[int]string
+	sumFilters    map[int]ModuleFilter
+	checkSumIndex []int
+	resolvers     []ResolverV2
+	//register order of resolvers
+	orders []int
+}
+
+// NewServer with path prefix (default is "/") and cache age of seconds @see NewCachePolicy
+func NewServer(prefix string, cacheAge int) *Server {
+	if prefix == "" {
+		prefix = "/"
+	}
+	return &Server{
+		Prefix:        prefix,
+		Cache:         NewCachePolicy(cacheAge),
+		Coalesce:      true,
+		names:         map[int]string{},
+		factories:     map[int]ResolverV2Factory{},
+		filters:       map[int]ModuleFilter{},
+		resolverIndex: make([]int, 0, 5),
+		checksum:      map[int]CheckSumResolver{},
+		checkSumNames: map[int]string{},
+		sumFilters:    map[int]ModuleFilter{},
+		checkSumIndex: make([]int, 0, 5),
+	}
+}
+
+func (s *Server) RegisterResolver(name string, order int, factory ResolverFactory) error {
+	return s.RegisterResolverV2(name, order, UpgradeResolverFactory(factory))
+}
+
+func (s *Server) RegisterResolverV2(name string, order int, factory ResolverV2Factory) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.names[order]; ok {
+		return errors.New("order is already exists")
+	}
+	s.names[order] = name
+	s.factories[order] = factory
+	s.resolverIndex = append(s.resolverIndex, order)
+	return nil
+}
+
+// register a checksum resolver serves all checksum databases
+func (s *Server) RegisterCheckSumResolver(order int, resolver CheckSumResolver) error {
+	return s.RegisterCheckSumResolverFor("", order, resolver)
+}
+
+// register a checksum resolver only serves the checksum database of name (as sum.golang.org), empty name for all.
+func (s *Server) RegisterCheckSumResolverFor(name string, order int, resolver CheckSumResolver) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.checksum[order]; ok {
+		return errors.New("order is already exists")
+	}
+	s.checksum[order] = resolver
+	s.checkSumNames[order] = name
+	s.checkSumIndex = append(s.checkSumIndex, order)
+	return nil
+}
+
+// only consult the resolver of order for modules selected by filter
+func (s *Server) SetResolverFilter(order int, filter ModuleFilter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.names[order]; !ok {
+		return errors.New("order is not exists")
+	}
+	s.filters[order] = filter
+	return nil
+}
+
+// only lookup modules selected by filter in the checksum resolver of order
+func (s *Server) SetCheckSumResolverFilter(order int, filter ModuleFilter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.checksum[order]; !ok {
+		return errors.New("order is not exists")
+	}
+	s.sumFilters[order] = filter
+	return nil
+}
+
+// prepare resolvers
+func (s *Server) Initial() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sort.Ints(s.resolverIndex)
+	resolvers := make([]ResolverV2, 0, len(s.resolverIndex))
+	for _, index := range s.resolverIndex {
+		resolvers = append(resolvers, s.factories[index](resolvers...))
+	}
+	s.resolvers = resolvers
+	s.orders = append([]int(nil), s.resolverIndex...)
+	sort.Ints(s.checkSumIndex)
+}
+
+// sorted if after Initial.
+func (s *Server) ResolverNames() (r []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r = make([]string, 0, len(s.resolverIndex))
+	for _, index := range s.resolverIndex {
+		r = append(r, s.names[index])
+	}
+	return
+}
+
+// sorted if after Initial.
+func (s *Server) ResolverFactories() (r []ResolverFactory) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sort.Ints(s.resolverIndex)
+	r = make([]ResolverFactory, 0, len(s.resolverIndex))
+	for _, index := range s.resolverIndex {
+		r = append(r, DowngradeResolverFactory(s.factories[index]))
+	}
+	return
+}
+
+// nil if before Initial.
+func (s *Server) Resolvers() (r []Resolver) {
+	resolvers := s.ResolversV2()
+	if resolvers == nil {
+		return nil
+	}
+	r = make([]Resolver, 0, len(resolvers))
+	for _, resolver := range resolvers {
+		r = append(r, DowngradeResolver(resolver))
+	}
+	return
+}
+
+// nil if before Initial.
+func (s *Server) ResolversV2() (r []ResolverV2) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.resolvers
+}
+
+//sorted checksum resolvers of the checksum database (all if name is empty) selects the module
+func (s *Server) checkSumResolvers(name string, module Module) (r []CheckSumResolver) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r = make([]CheckSumResolver, 0, len(s.checkSumIndex))
+	for _, index := range s.checkSumIndex {
+		if n := s.checkSumNames[index]; (name == "" || n == "" || n == name) && s.sumFilters[index].Match(module) {
+			r = append(r, s.checksum[index])
+		}
+	}
+	return
+}
+
+//the error when all resolvers failed: the first transient error, else ErrGone if any, else ErrNotFound
+func resolveError(err error, e error) error {
+	if !IsNotFound(err) {
+		return err
+	}
+	if !IsNotFound(e) || errors.Is(e, ErrGone) {
+		return e
+	}
+	return err
+}
+
+//resolvers select the module with register orders, and the Strategy
+func (s *Server) ordered(module Module) ([]ordered, *ParallelStrategy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	resolvers := make([]ordered, 0, len(s.resolvers))
+	for i, resolver := range s.resolvers {
+		order := i
+		if i < len(s.orders) {
+			order = s.orders[i]
+		}
+		if !s.filters[order].Match(module) {
+			continue
+		}
+		if s.Metrics != nil {
+			resolver = meteredResolver{resolver, s.names[order], s.Metrics}
+		}
+		resolvers = append(resolvers, ordered{order, resolver})
+	}
+	return resolvers, s.Strategy
+}
+
+//resolve with Strategy or one by one, release is called with successful values which are not used
+func (s *Server) resolve(ctx context.Context, module Module, call resolveCall, release func(interface{})) (interface{}, error) {
+	resolvers, strategy := s.ordered(module)
+	if strategy != nil {
+		v, order, err := strategy.resolve(ctx, resolvers, call, release)
+		if err == nil {
+			s.served(ctx, order)
+		}
+		return v, err
+	}
+	err := ErrNotFound
+	for _, r := range resolvers {
+		if e := ctx.Err(); e != nil {
+			return nil, e
+		}
+		v, e := call(ctx, r.resolver)
+		if e == nil {
+			s.served(ctx, r.order)
+			return v, nil
+		}
+		err = resolveError(err, e)
+	}
+	return nil, err
+}
+
+//resolve once for identical concurrent calls if Coalesce
+func (s *Server) coalesce(ctx context.Context, cmd Cmd, module Module, version Version, fn func(ctx context.Context) (interface{}, error),
+	share func(v interface{}, n int, cancel context.CancelFunc) ([]interface{}, error), release func(interface{})) (interface{}, error) {
+	s.lock.Lock()
+	coalesce := s.Coalesce
+	s.lock.Unlock()
+	if !coalesce {
+		return fn(ctx)
+	}
+	//the name of serving resolvers is shared with the value
+	v, err := s.flights.do(ctx, flightKey(cmd, module, version), func(ctx context.Context) (interface{}, error) {
+		rec := new(servedBy)
+		v, err := fn(withServedBy(ctx, rec))
+		return servedValue{v, rec.get()}, err
+	}, func(v interface{}, n int, cancel context.CancelFunc) ([]interface{}, error) {
+		sv := v.(servedValue)
+		if share == nil {
+			cancel()
+			return repeat(sv, n), nil
+		}
+		values, err := share(sv.value, n, cancel)
+		for i := range values {
+			values[i] = servedValue{values[i], sv.name}
+		}
+		return values, err
+	}, func(v interface{}) {
+		if release != nil {
+			release(v.(servedValue).value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sv := v.(servedValue)
+	if rec, ok := ctx.Value(servedByKey{}).(*servedBy); ok {
+		rec.set(sv.name)
+	}
+	return sv.value, nil
+}
+
+//fetch the Versions of module @see ResolverV2 and MergeVersions
+func (s *Server) ResolveVersions(ctx context.Context, module Module) (Versions, error) {
+	v, err := s.coalesce(ctx, CmdList, module, UndefinedVersion, func(ctx context.Context) (interface{}, error) {
+		return s.resolveVersions(ctx, module)
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.(Versions), nil
+}
+
+func (s *Server) resolveVersions(ctx context.Context, module Module) (Versions, error) {
+	call := func(ctx context.Context, r ResolverV2) (interface{}, error) {
+		return r.Versions(ctx, module)
+	}
+	s.lock.Lock()
+	merge := s.MergeVersions
+	s.lock.Unlock()
+	if merge {
+		return s.mergeVersions(ctx, module, call)
+	}
+	//the first non-empty list is used, the list is empty only if no resolver has versions and some answered empty
+	var empty int32
+	v, err := s.resolve(ctx, module, func(ctx context.Context, r ResolverV2) (interface{}, error) {
+		v, err := call(ctx, r)
+		if err == nil && len(v.(Versions)) == 0 {
+			atomic.StoreInt32(&empty, 1)
+			return nil, ErrNotFound
+		}
+		return v, err
+	}, nil)
+	if err != nil {
+		if IsNotFound(err) && atomic.LoadInt32(&empty) == 1 {
+			return Versions{}, nil
+		}
+		return nil, err
+	}
+	return v.(Versions), nil
+}
+
+//query all resolvers concurrently (with timeouts of Strategy) and union the versions, fails only if all failed
+func (s *Server) mergeVersions(ctx context.Context, module Module, call resolveCall) (Versions, error) {
+	resolvers, strategy := s.ordered(module)
+	answers := make(chan answer, len(resolvers))
+	for i, r := range resolvers {
+		var timeout time.Duration
+		if strategy != nil {
+			timeout = strategy.timeout(r.order)
+		}
+		var rc context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			rc, cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			rc, cancel = context.WithCancel(ctx)
+		}
+		go func(i int, resolver ResolverV2, cancel context.CancelFunc) {
+			defer cancel()
+			v, e := call(rc, resolver)
+			answers <- answer{i, v, e}
+		}(i, r.resolver, cancel)
+	}
+	results := make([]answer, len(resolvers))
+	for range resolvers {
+		a := <-answers
+		results[a.index] = a
+	}
+	var lists []Versions
+	var orders []int
+	err := ErrNotFound
+	for i, a := range results {
+		if a.err != nil {
+			err = resolveError(err, a.err)
+			continue
+		}
+		orders = append(orders, resolvers[i].order)
+		lists = append(lists, a.value.(Versions))
+	}
+	if len(orders) == 0 {
+		return nil, err
+	}
+	s.served(ctx, orders...)
+	return MergeVersions(lists...), nil
+}
+
+// fetch the Info of a module with version @see ResolverV2
+func (s *Server) ResolveInfo(ctx context.Context, module Module, version Version) (*Info, error) {
+	v, err := s.coalesce(ctx, CmdInfo, module, version, func(ctx context.Context) (interface{}, error) {
+		return s.resolve(ctx, module, func(ctx context.Context, r ResolverV2) (interface{}, error) {
+			return r.Info(ctx, module, version)
+		}, nil)
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Info), nil
+}
+
+// fetch the GoMod of a module with version @see ResolverV2
+func (s *Server) ResolveMod(ctx context.Context, module Module, version Version) (GoMod, error) {
+	v, err := s.coalesce(ctx, CmdMod, module, version, func(ctx context.Context) (interface{}, error) {
+		return s.resolve(ctx, module, func(ctx context.Context, r ResolverV2) (interface{}, error) {
+			return r.Mod(ctx, module, version)
+		}, nil)
+	}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return v.(GoMod), nil
+}
+
+// fetch the GoZip of a module with version @see ResolverV2
+func (s *Server) ResolveZip(ctx context.Context, module Module, version Version) (GoZip, error) {
+	v, err := s.coalesce(ctx, CmdZip, module, version, func(ctx context.Context) (interface{}, error) {
+		return s.resolve(ctx, module, func(ctx context.Context, r ResolverV2) (interface{}, error) {
+			return r.Zip(ctx, module, version)
+		}, closeZip)
+	}, shareZip, closeZip)
+	if err != nil {
+		return nil, err
+	}
+	z, _ := v.(GoZip)
+	return z, nil
+}
+
+//close an unused zip
+func closeZip(v interface{}) {
+	if z, ok := v.(GoZip); ok && z != nil {
+		_ = z.Close()
+	}
+}
+
+// the checksum database of name (empty for any) is supported
+func (s *Server) SumResolveSupported(name string) bool {
+	for _, r := range s.checkSumResolvers(name, UndefinedModule) {
+		if r.Supported() {
+			return true
+		}
+	}
+	return false
+}
+
+//$base/latest of checksum database name (empty for any)
+func (s *Server) SumResolveLatest(name string) []byte {
+	for _, r := range s.checkSumResolvers(name, UndefinedModule) {
+		if m := r.Latest(); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+//$base/lookup/$module@$version of checksum database name (empty for any)
+func (s *Server) SumResolveLookup(name string, module Module, version Version) []byte {
+	for _, r := range s.checkSumResolvers(name, module) {
+		if m := r.Lookup(module, version); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+//$base/tile/$H/$L/$K[.p/$W]  also process tile data $base/tile/$H/data/$K[.p/$W] of checksum database name (empty for any)
+func (s *Server) SumResolveTile(name string, path string) []byte {
+	for _, r := range s.checkSumResolvers(name, UndefinedModule) {
+		if m := r.Tile(path); m != nil {
+			return m
+		}
+	}
+	return nil
+}
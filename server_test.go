@@ -0,0 +1,342 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	public := NewServer("/public/", 60)
+	private := NewServer("/private/", 0)
+	assert.Nil(t, public.RegisterResolver("public", 0, func(resolvers ...Resolver) Resolver {
+		return JustTestResolver(0)
+	}))
+	assert.Nil(t, private.RegisterResolver("private", 0, func(resolvers ...Resolver) Resolver {
+		return zipResolver{}
+	}))
+	assert.NotNil(t, private.RegisterResolver("private", 0, func(resolvers ...Resolver) Resolver {
+		return zipResolver{}
+	}))
+	assert.Nil(t, private.RegisterCheckSumResolver(0, CheckSumResolverNotSupportInstance))
+	public.Initial()
+	private.Initial()
+	assert.Equal(t, []string{"public"}, public.ResolverNames())
+	assert.Equal(t, []string{"private"}, private.ResolverNames())
+	assert.Len(t, public.Resolvers(), 1)
+
+	w := httptest.NewRecorder()
+	public.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/git.x/some/@v/list", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "1\n2\n3", w.Body.String())
+
+	w = httptest.NewRecorder()
+	private.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private/git.x/some/@v/v1.0.0.mod", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "must-revalidate, no-cache, no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "module git.x/some\n", w.Body.String())
+
+	for _, path := range []string{"/public/git.x/some/@v/list", "/private/sumdb/sum.x/supported"} {
+		w = httptest.NewRecorder()
+		private.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestServer_Resolve(t *testing.T) {
+	s := NewServer("/", 60)
+	ctx := context.Background()
+	transient := errors.New("transient")
+
+	s.resolvers = []ResolverV2{failedResolver{ErrNotFound}, failedResolver{ErrGone}, failedResolver{ErrNotFound}}
+	_, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, ErrGone, err)
+
+	s.resolvers = []ResolverV2{failedResolver{ErrGone}, failedResolver{transient}, UpgradeResolver(zipResolver{})}
+	m, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("module git.x/some\n"), m)
+	_, err = s.ResolveInfo(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, transient, err)
+
+	for path, status := range map[string]int{
+		"/git.x/some/@v/v1.0.0.mod":  http.StatusOK,
+		"/git.x/some/@v/v1.0.0.zip":  http.StatusOK,
+		"/git.x/some/@v/v1.0.0.info": http.StatusInternalServerError,
+		"/git.x/some/@v/list":        http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, status, w.Code, path)
+	}
+	s.resolvers = []ResolverV2{failedResolver{ErrNotFound}}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/list", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	s.resolvers = []ResolverV2{failedResolver{ErrGone}}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/list", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+//a seekable zip knows it's hash
+type hashedZip struct {
+	*bytes.Reader
+}
+
+func (z hashedZip) Close() error {
+	return nil
+}
+
+func (z hashedZip) Hash() string {
+	return "h1:abc="
+}
+
+//a resolver serves hashedZip
+type hashedZipResolver struct {
+	zipResolver
+}
+
+func (z hashedZipResolver) Zip(Module, Version) GoZip {
+	return hashedZip{bytes.NewReader([]byte("SOME ZIP"))}
+}
+
+func TestServer_Zip(t *testing.T) {
+	s := NewServer("/", 60)
+	s.resolvers = []ResolverV2{UpgradeResolver(hashedZipResolver{})}
+	get := func(header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/git.x/some/@v/v1.0.0.zip", nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		s.ServeHTTP(w, r)
+		return w
+	}
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, "8", w.Header().Get("Content-Length"))
+	assert.Equal(t, `"h1:abc="`, w.Header().Get("ETag"))
+	assert.Equal(t, "SOME ZIP", w.Body.String())
+
+	w = get("If-None-Match", `"h1:abc="`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = get("Range", "bytes=5-")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 5-7/8", w.Header().Get("Content-Range"))
+	assert.Equal(t, "ZIP", w.Body.String())
+
+	//not seekable
+	s.resolvers = []ResolverV2{UpgradeResolver(zipResolver{})}
+	w = get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.True(t, w.Body.Len() > 0)
+}
+
+//a zip counts reading
+type countingZip struct {
+	size  int64
+	reads *int
+}
+
+func (z countingZip) Read(p []byte) (int, error) {
+	*z.reads++
+	return 0, io.EOF
+}
+
+func (z countingZip) Close() error {
+	return nil
+}
+
+func (z countingZip) Size() int64 {
+	return z.size
+}
+
+type countingZipResolver struct {
+	zipResolver
+	reads *int
+}
+
+func (z countingZipResolver) Zip(Module, Version) GoZip {
+	return countingZip{12, z.reads}
+}
+
+func TestServer_Methods(t *testing.T) {
+	reads := 0
+	s := NewServer("/", 60)
+	s.resolvers = []ResolverV2{UpgradeResolver(countingZipResolver{reads: &reads})}
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	w := serve(http.MethodHead, "/git.x/some/@v/v1.0.0.zip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "12", w.Header().Get("Content-Length"))
+	assert.Equal(t, 0, reads)
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = serve(http.MethodHead, "/git.x/some/@v/v1.0.0.mod")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "18", w.Header().Get("Content-Length"))
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = serve(http.MethodHead, "/git.x/some/@v/v1.0.0.txt")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+	w = serve(http.MethodGet, "/git.x/some/@v/v1.0.0.txt")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotEqual(t, 0, w.Body.Len())
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions} {
+		w = serve(method, "/git.x/some/@v/v1.0.0.mod")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code, method)
+		assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"), method)
+	}
+
+	s.CORS = "*"
+	w = serve(http.MethodOptions, "/git.x/some/@v/v1.0.0.mod")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	w = serve(http.MethodGet, "/git.x/some/@v/v1.0.0.mod")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "module git.x/some\n", w.Body.String())
+	w = serve(http.MethodPost, "/git.x/some/@v/v1.0.0.mod")
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+}
+
+//a ResolverV2 answers Versions
+type versionsResolver struct {
+	failedResolver
+	versions Versions
+}
+
+func (v versionsResolver) Versions(context.Context, Module) (Versions, error) {
+	return v.versions, nil
+}
+
+func TestServer_MergeVersions(t *testing.T) {
+	s := NewServer("/", 0)
+	s.resolvers = []ResolverV2{
+		versionsResolver{versions: Versions{"v1.1.0", "v1.0.0"}},
+		failedResolver{errors.New("transient")},
+		versionsResolver{versions: Versions{"v1.2.0", "v1.1.0", "v1.1.1-0.20211010101010-abcdefabcdef"}},
+	}
+	list := func() string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git.x/some/@v/list", nil))
+		return w.Body.String()
+	}
+	assert.Equal(t, "v1.0.0\nv1.1.0", list())
+	s.MergeVersions = true
+	assert.Equal(t, "v1.0.0\nv1.1.0\nv1.2.0", list())
+
+	s.resolvers = []ResolverV2{failedResolver{ErrNotFound}, failedResolver{ErrGone}}
+	_, err := s.ResolveVersions(context.Background(), "git.x/some")
+	assert.Equal(t, ErrGone, err)
+}
+
+//an empty list does not hide later resolvers
+func TestServer_EmptyVersions(t *testing.T) {
+	ctx := context.Background()
+	for _, strategy := range []*ParallelStrategy{nil, {}} {
+		s := NewServer("/", 0)
+		s.Strategy = strategy
+		s.resolvers = []ResolverV2{
+			versionsResolver{failedResolver{ErrNotFound}, nil},
+			versionsResolver{failedResolver{ErrNotFound}, Versions{"v1.0.0"}},
+		}
+		v, err := s.ResolveVersions(ctx, "git.x/some")
+		assert.Nil(t, err)
+		assert.Equal(t, Versions{"v1.0.0"}, v)
+
+		//known module without versions
+		s.resolvers = []ResolverV2{
+			failedResolver{ErrNotFound},
+			versionsResolver{failedResolver{ErrNotFound}, Versions{}},
+		}
+		v, err = s.ResolveVersions(ctx, "git.x/some")
+		assert.Nil(t, err)
+		assert.Len(t, v, 0)
+		s.resolvers = []ResolverV2{failedResolver{ErrNotFound}}
+		_, err = s.ResolveVersions(ctx, "git.x/some")
+		assert.True(t, IsNotFound(err))
+	}
+}
+
+//a checksum database answers it's name
+type namedCheckSum string
+
+func (n namedCheckSum) Supported() bool {
+	return true
+}
+
+func (n namedCheckSum) Latest() []byte {
+	return []byte(n)
+}
+
+func (n namedCheckSum) Lookup(Module, Version) []byte {
+	return []byte(n)
+}
+
+func (n namedCheckSum) Tile(string) []byte {
+	return []byte(n)
+}
+
+func TestServer_SumDB(t *testing.T) {
+	s := NewServer("/", 60)
+	assert.Nil(t, s.RegisterCheckSumResolverFor("sum.x", 0, namedCheckSum("x")))
+	assert.Nil(t, s.RegisterCheckSumResolverFor("sum.y", 1, namedCheckSum("y")))
+	assert.NotNil(t, s.RegisterCheckSumResolverFor("sum.z", 1, namedCheckSum("z")))
+	s.Initial()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(t, "x", get("/sumdb/sum.x/latest").Body.String())
+	assert.Equal(t, "y", get("/sumdb/sum.y/lookup/git.x/some@v1.0.0").Body.String())
+	assert.Equal(t, "y", get("/sumdb/sum.y/tile/8/0/001").Body.String())
+	assert.Equal(t, http.StatusOK, get("/sumdb/sum.y/supported").Code)
+	for _, path := range []string{"/sumdb/sum.z/supported", "/sumdb/sum.z/latest", "/sumdb/latest"} {
+		assert.Equal(t, http.StatusNotFound, get(path).Code, path)
+	}
+	assert.Equal(t, []byte("x"), s.SumResolveLatest(""))
+
+	//serves all checksum databases
+	assert.Nil(t, s.RegisterCheckSumResolver(2, namedCheckSum("all")))
+	s.Initial()
+	assert.Equal(t, "all", get("/sumdb/sum.z/latest").Body.String())
+	assert.Equal(t, "x", get("/sumdb/sum.x/latest").Body.String())
+}
@@ -0,0 +1,173 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// ParallelStrategy resolve with resolvers grouped into tiers: tiers are queried one by one in ascending order,
+// resolvers of a tier are queried concurrently, each with a timeout. the first successful answer is returned and
+// the rest are canceled, when several resolvers of a tier answer, the one registered with lower order is preferred.
+type ParallelStrategy struct {
+	//tier of resolvers by register order, resolvers not listed are in tier 0
+	Tiers map[int]int
+	//timeout of resolvers by register order, Timeout is used for resolvers not listed
+	Timeouts map[int]time.Duration
+	//default timeout of resolvers, no timeout if not positive
+	Timeout time.Duration
+}
+
+//a resolver with it's register order
+type ordered struct {
+	order    int
+	resolver ResolverV2
+}
+
+//tiers of resolvers, resolvers are sorted by register order
+func (p *ParallelStrategy) tiers(resolvers []ordered) [][]ordered {
+	byTier := map[int][]ordered{}
+	tiers := make([]int, 0, len(resolvers))
+	for _, r := range resolvers {
+		t := p.Tiers[r.order]
+		if _, ok := byTier[t]; !ok {
+			tiers = append(tiers, t)
+		}
+		byTier[t] = append(byTier[t], r)
+	}
+	sort.Ints(tiers)
+	g := make([][]ordered, 0, len(tiers))
+	for _, t := range tiers {
+		g = append(g, byTier[t])
+	}
+	return g
+}
+
+func (p *ParallelStrategy) timeout(order int) time.Duration {
+	if t, ok := p.Timeouts[order]; ok {
+		return t
+	}
+	return p.Timeout
+}
+
+//answer of a resolver
+type answer struct {
+	index int
+	value interface{}
+	err   error
+}
+
+//a call of resolver
+type resolveCall func(ctx context.Context, resolver ResolverV2) (interface{}, error)
+
+//resolve with tiers, returns the value and register order of the answered resolver.
+//release is called with successful values which are not used
+func (p *ParallelStrategy) resolve(ctx context.Context, resolvers []ordered, call resolveCall, release func(interface{})) (interface{}, int, error) {
+	err := ErrNotFound
+	for _, tier := range p.tiers(resolvers) {
+		if e := ctx.Err(); e != nil {
+			return nil, 0, e
+		}
+		v, order, e := p.resolveTier(ctx, tier, call, release)
+		if e == nil {
+			return v, order, nil
+		}
+		err = resolveError(err, e)
+	}
+	return nil, 0, err
+}
+
+func (p *ParallelStrategy) resolveTier(ctx context.Context, tier []ordered, call resolveCall, release func(interface{})) (interface{}, int, error) {
+	answers := make(chan answer, len(tier))
+	cancels := make([]context.CancelFunc, len(tier))
+	timers := make([]*time.Timer, len(tier))
+	for i, r := range tier {
+		rc, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		//the timeout only limits the time to answer, a successful answer (as a streaming zip) is not canceled
+		if t := p.timeout(r.order); t > 0 {
+			timers[i] = time.AfterFunc(t, cancel)
+		}
+		go func(i int, resolver ResolverV2) {
+			v, e := call(rc, resolver)
+			answers <- answer{i, v, e}
+		}(i, r.resolver)
+	}
+	//all resolvers but the winner are canceled when tier is done
+	winner := -1
+	defer func() {
+		for i, cancel := range cancels {
+			if i != winner {
+				cancel()
+				if timers[i] != nil {
+					timers[i].Stop()
+				}
+			}
+		}
+	}()
+	results := make([]*answer, len(tier))
+	err := ErrNotFound
+	next := 0
+	for received := 0; received < len(tier); received++ {
+		var a answer
+		select {
+		case a = <-answers:
+		case <-ctx.Done():
+			for _, r := range results {
+				if r != nil && r.err == nil && release != nil {
+					release(r.value)
+				}
+			}
+			go drain(answers, len(tier)-received, release)
+			return nil, 0, ctx.Err()
+		}
+		if a.err == nil && timers[a.index] != nil {
+			timers[a.index].Stop()
+		}
+		results[a.index] = &a
+		//answers are accepted in order of priority
+		for ; next < len(tier) && results[next] != nil; next++ {
+			if results[next].err != nil {
+				err = resolveError(err, results[next].err)
+				continue
+			}
+			winner = next
+			for i, r := range results {
+				if i != next && r != nil && r.err == nil && release != nil {
+					release(r.value)
+				}
+			}
+			go drain(answers, len(tier)-received-1, release)
+			return results[next].value, tier[next].order, nil
+		}
+	}
+	return nil, 0, err
+}
+
+//wait and release remaining answers
+func drain(answers chan answer, n int, release func(interface{})) {
+	for ; n > 0; n-- {
+		a := <-answers
+		if a.err == nil && release != nil {
+			release(a.value)
+		}
+	}
+}
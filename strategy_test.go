@@ -0,0 +1,179 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//a ResolverV2 answers .mod after delay, or fails with error
+type delayedResolver struct {
+	mod      GoMod
+	err      error
+	delay    time.Duration
+	calls    *int32
+	canceled *int32
+	closed   *int32
+}
+
+func (d delayedResolver) wait(ctx context.Context) error {
+	if d.calls != nil {
+		atomic.AddInt32(d.calls, 1)
+	}
+	select {
+	case <-time.After(d.delay):
+		return d.err
+	case <-ctx.Done():
+		if d.canceled != nil {
+			atomic.AddInt32(d.canceled, 1)
+		}
+		return ctx.Err()
+	}
+}
+
+func (d delayedResolver) Versions(context.Context, Module) (Versions, error) {
+	return nil, ErrNotFound
+}
+
+func (d delayedResolver) Info(context.Context, Module, Version) (*Info, error) {
+	return nil, ErrNotFound
+}
+
+func (d delayedResolver) Mod(ctx context.Context, _ Module, _ Version) (GoMod, error) {
+	if err := d.wait(ctx); err != nil {
+		return "", err
+	}
+	return d.mod, nil
+}
+
+func (d delayedResolver) Zip(ctx context.Context, _ Module, _ Version) (GoZip, error) {
+	if err := d.wait(ctx); err != nil {
+		return nil, err
+	}
+	return closingZip{ioutil.NopCloser(strings.NewReader(string(d.mod))), d.closed}, nil
+}
+
+type closingZip struct {
+	GoZip
+	closed *int32
+}
+
+func (c closingZip) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return nil
+}
+
+func newStrategyServer(strategy *ParallelStrategy, resolvers ...ResolverV2) *Server {
+	s := NewServer("/", 0)
+	s.Strategy = strategy
+	for i, r := range resolvers {
+		r := r
+		_ = s.RegisterResolverV2("", i, func(...ResolverV2) ResolverV2 {
+			return r
+		})
+	}
+	s.Initial()
+	return s
+}
+
+func TestParallelStrategy(t *testing.T) {
+	ctx := context.Background()
+	var canceled, calls int32
+
+	//lower order is preferred
+	s := newStrategyServer(&ParallelStrategy{},
+		delayedResolver{mod: "slow", delay: 50 * time.Millisecond},
+		delayedResolver{mod: "fast"},
+	)
+	m, err := s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("slow"), m)
+
+	//timeout, and the rest are canceled
+	s = newStrategyServer(&ParallelStrategy{Timeouts: map[int]time.Duration{0: 20 * time.Millisecond}},
+		delayedResolver{mod: "slow", delay: time.Minute},
+		delayedResolver{mod: "fast"},
+		delayedResolver{mod: "slower", delay: time.Minute, canceled: &canceled},
+	)
+	start := time.Now()
+	m, err = s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("fast"), m)
+	assert.True(t, time.Since(start) < time.Second)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&canceled))
+
+	//tiers
+	s = newStrategyServer(&ParallelStrategy{Tiers: map[int]int{0: 1}},
+		delayedResolver{mod: "second", calls: &calls},
+		delayedResolver{mod: "first"},
+		delayedResolver{err: ErrGone},
+	)
+	m, err = s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("first"), m)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	//errors
+	transient := errors.New("transient")
+	s = newStrategyServer(&ParallelStrategy{Tiers: map[int]int{2: 1}},
+		delayedResolver{err: ErrNotFound},
+		delayedResolver{err: ErrGone},
+		delayedResolver{err: transient},
+	)
+	_, err = s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, transient, err)
+	s.Strategy.Tiers = nil
+	_, err = s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, transient, err)
+	s.Strategy.Tiers = map[int]int{2: -1}
+	_, err = s.ResolveMod(ctx, "git.x/some", "v1.0.0")
+	assert.Equal(t, transient, err)
+
+	//unused zips are closed
+	var closed int32
+	s = newStrategyServer(&ParallelStrategy{},
+		delayedResolver{mod: "first", delay: 20 * time.Millisecond, closed: &closed},
+		delayedResolver{mod: "second", closed: &closed},
+		delayedResolver{mod: "third", delay: 40 * time.Millisecond, closed: &closed},
+	)
+	z, err := s.ResolveZip(ctx, "git.x/some", "v1.0.0")
+	if assert.Nil(t, err) {
+		b, _ := ioutil.ReadAll(z)
+		assert.Equal(t, "first", string(b))
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed))
+	assert.Nil(t, z.Close())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&closed))
+
+	//canceled
+	canceledCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	s = newStrategyServer(&ParallelStrategy{}, delayedResolver{mod: "slow", delay: time.Minute})
+	_, err = s.ResolveMod(canceledCtx, "git.x/some", "v1.0.0")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
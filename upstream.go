@@ -0,0 +1,188 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	errUpstream = errors.New("upstream failure")
+)
+
+// UpstreamResolver is a ResolverV2 forward commands to upstream GO Proxy servers.
+// 404 and 410 of upstream are reported as ErrNotFound and ErrGone.
+type UpstreamResolver struct {
+	Client  *http.Client
+	proxies []upstream
+}
+
+type upstream struct {
+	url string
+	//fallback to next proxy on any error, or only on 404 and 410
+	fallback bool
+}
+
+// NewUpstreamResolver with a GOPROXY style list: proxies separated by comma only fallback to next on 404 or 410,
+// proxies separated by pipe fallback to next on any error. 'direct' is skipped, and 'off' ends the list.
+// use http.DefaultClient when client is nil.
+func NewUpstreamResolver(goproxy string, client *http.Client) *UpstreamResolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := &UpstreamResolver{Client: client}
+	for goproxy != "" {
+		var p string
+		fallback := false
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			p = goproxy[:i]
+			fallback = goproxy[i] == '|'
+			goproxy = goproxy[i+1:]
+		} else {
+			p = goproxy
+			goproxy = ""
+		}
+		p = strings.TrimSpace(p)
+		switch p {
+		case "", "direct":
+			continue
+		case "off":
+			return u
+		}
+		u.proxies = append(u.proxies, upstream{url: strings.TrimSuffix(p, "/"), fallback: fallback})
+	}
+	return u
+}
+
+// UpstreamResolverFactory @see NewUpstreamResolver
+func UpstreamResolverFactory(goproxy string, client *http.Client) ResolverV2Factory {
+	return func(resolvers ...ResolverV2) ResolverV2 {
+		return NewUpstreamResolver(goproxy, client)
+	}
+}
+
+//fetch from upstreams, the response is 200 if no error
+func (u *UpstreamResolver) fetch(ctx context.Context, cmd Cmd, module Module, version Version) (*http.Response, error) {
+	err := ErrNotFound
+	for _, p := range u.proxies {
+		url := BuildCmd(p.url, cmd, module, version)
+		if url == "" {
+			return nil, ErrNotFound
+		}
+		req, e := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if e != nil {
+			return nil, e
+		}
+		res, e := u.Client.Do(req)
+		if e == nil && res.StatusCode == http.StatusOK {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if e == nil {
+			_ = res.Body.Close()
+			switch res.StatusCode {
+			case http.StatusNotFound:
+				continue
+			case http.StatusGone:
+				err = ErrGone
+				continue
+			}
+			e = fmt.Errorf("%w: %s response %s", errUpstream, p.url, res.Status)
+		} else {
+			e = fmt.Errorf("%w: %v", errUpstream, e)
+		}
+		if p.fallback {
+			continue
+		}
+		return nil, e
+	}
+	return nil, err
+}
+
+func (u *UpstreamResolver) fetchBytes(ctx context.Context, cmd Cmd, module Module, version Version) ([]byte, error) {
+	res, err := u.fetch(ctx, cmd, module, version)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUpstream, err)
+	}
+	return b, nil
+}
+
+func (u *UpstreamResolver) Versions(ctx context.Context, module Module) (Versions, error) {
+	b, err := u.fetchBytes(ctx, CmdList, module, UndefinedVersion)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVersions(string(b)), nil
+}
+
+func (u *UpstreamResolver) Info(ctx context.Context, module Module, version Version) (*Info, error) {
+	cmd := CmdInfo
+	if version == LatestVersion {
+		cmd = CmdLatest
+	}
+	b, err := u.fetchBytes(ctx, cmd, module, version)
+	if err != nil {
+		return nil, err
+	}
+	i := new(Info)
+	if err = i.UnMarshal(b); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUpstream, err)
+	}
+	return i, nil
+}
+
+func (u *UpstreamResolver) Mod(ctx context.Context, module Module, version Version) (GoMod, error) {
+	b, err := u.fetchBytes(ctx, CmdMod, module, version)
+	if err != nil {
+		return "", err
+	}
+	return GoMod(b), nil
+}
+
+//the zip is streamed from upstream
+func (u *UpstreamResolver) Zip(ctx context.Context, module Module, version Version) (GoZip, error) {
+	res, err := u.fetch(ctx, CmdZip, module, version)
+	if err != nil {
+		return nil, err
+	}
+	return upstreamZip{res.Body, res.ContentLength}, nil
+}
+
+//a zip streamed from upstream, size is -1 if unknown
+type upstreamZip struct {
+	io.ReadCloser
+	size int64
+}
+
+func (z upstreamZip) Size() int64 {
+	return z.size
+}
@@ -0,0 +1,123 @@
+/*
+ *
+ * Copyright (C) 2021.  Zen.Liu
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mpc
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//an upstream serves a fixed module
+func newTestUpstream(module string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+module+"/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("v1.0.0\nv1.1.0\n"))
+	})
+	mux.HandleFunc("/"+module+"/@latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(Info{Version: "v1.1.0", Time: time.Date(2021, 10, 10, 0, 0, 0, 0, time.UTC)}.Marshal())
+	})
+	mux.HandleFunc("/"+module+"/@v/v1.0.0.info", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(Info{Version: "v1.0.0", Time: time.Date(2021, 10, 9, 0, 0, 0, 0, time.UTC)}.Marshal())
+	})
+	mux.HandleFunc("/"+module+"/@v/v1.0.0.mod", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("module " + module + "\n"))
+	})
+	mux.HandleFunc("/"+module+"/@v/v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ZIP"))
+	})
+	return httptest.NewServer(mux)
+}
+
+//an upstream always response with status
+func newStatusUpstream(status int, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		w.WriteHeader(status)
+	}))
+}
+
+func TestUpstreamResolver(t *testing.T) {
+	up := newTestUpstream("git.x/some")
+	defer up.Close()
+	var gone, failed int32
+	goneUp := newStatusUpstream(http.StatusGone, &gone)
+	defer goneUp.Close()
+	failedUp := newStatusUpstream(http.StatusInternalServerError, &failed)
+	defer failedUp.Close()
+
+	ctx := context.Background()
+	u := UpstreamResolverFactory("direct,"+goneUp.URL+","+failedUp.URL+"|"+up.URL+"/,off,http://127.0.0.1:1", nil)()
+	versions, err := u.Versions(ctx, "git.x/some")
+	assert.Nil(t, err)
+	assert.Equal(t, ParseVersions("v1.0.0\nv1.1.0\n"), versions)
+	info, err := u.Info(ctx, "git.x/some", LatestVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, &Info{Version: "v1.1.0", Time: time.Date(2021, 10, 10, 0, 0, 0, 0, time.UTC)}, info)
+	info, err = u.Info(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, &Info{Version: "v1.0.0", Time: time.Date(2021, 10, 9, 0, 0, 0, 0, time.UTC)}, info)
+	mod, err := u.Mod(ctx, "git.x/some", "v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, GoMod("module git.x/some\n"), mod)
+	z, err := u.Zip(ctx, "git.x/some", "v1.0.0")
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(3), z.(ZipSizer).Size())
+		b, err := ioutil.ReadAll(z)
+		assert.Nil(t, err)
+		assert.Equal(t, "ZIP", string(b))
+		assert.Nil(t, z.Close())
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(&gone))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&failed))
+
+	//unknown
+	_, err = u.Versions(ctx, "git.x/none")
+	assert.True(t, errors.Is(err, ErrGone))
+	assert.True(t, IsNotFound(err))
+	_, err = u.Info(ctx, "git.x/some", "v1.1.0")
+	assert.True(t, IsNotFound(err))
+	_, err = u.Zip(ctx, "git.x/some", "v1.1.0")
+	assert.True(t, IsNotFound(err))
+
+	//comma does not fallback on errors
+	u = NewUpstreamResolver(failedUp.URL+","+up.URL, nil)
+	_, err = u.Mod(ctx, "git.x/some", "v1.0.0")
+	assert.NotNil(t, err)
+	assert.False(t, IsNotFound(err))
+
+	//canceled
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	u = NewUpstreamResolver(up.URL, nil)
+	_, err = u.Mod(canceled, "git.x/some", "v1.0.0")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	//as Resolver
+	r := DowngradeResolver(u)
+	assert.Equal(t, GoMod("module git.x/some\n"), r.Mod("git.x/some", "v1.0.0"))
+	assert.Equal(t, GoMod(""), r.Mod("git.x/some", "v1.1.0"))
+	assert.Equal(t, u, UpgradeResolver(r))
+}